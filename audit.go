@@ -1,13 +1,14 @@
 package audit
 
 import (
-	"encoding/json"
-	opcode "github.com/vela-security/vela-opcode"
 	"github.com/vela-security/vela-public/assert"
 	"github.com/vela-security/vela-public/lua"
+	"net/http"
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -19,12 +20,38 @@ var typeof = reflect.TypeOf((*Audit)(nil)).String()
 
 type Audit struct {
 	lua.ProcEx
-	cfg *config
-	fd  *os.File
+	cfg   atomic.Pointer[config]
+	mu    sync.Mutex //reload
+	fmu   sync.RWMutex
+	fd    *os.File
+	hook  hook
+	env   Env
+	mem   *memStore
+	track *inhibitTrack
+	roll  *rollup
+	dlv   *delivery
+	db    *store
+	stop  chan struct{}
+	loops sync.WaitGroup //rollup , retry , heartbeat 后台协程
+	stat  *stats
+
+	written uint64 //file bytes
+	msrvMu  sync.Mutex
+	msrv    *http.Server
+
+	closing  int32
+	inflight int64
 }
 
 func withConfig(cfg *config) *Audit {
-	adt := &Audit{cfg: cfg}
+	adt := &Audit{}
+	adt.cfg.Store(cfg)
+	adt.mem = newMemStore(func() time.Time { return adt.environ().Now() })
+	adt.track = newInhibitTrack(func() time.Time { return adt.environ().Now() })
+	adt.roll = newRollup()
+	adt.dlv = newDelivery()
+	adt.db = newStore(func() time.Time { return adt.environ().Now() })
+	adt.stat = newStats()
 	adt.V(lua.PTInit, typeof)
 	return adt
 }
@@ -33,35 +60,134 @@ func New() *Audit {
 	return withConfig(velaMinConfig())
 }
 
-func (a *Audit) openFile() {
-	fd, err := os.OpenFile(a.cfg.file, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
-	if err != nil {
-		xEnv.Errorf("%s open file error %v", a.Name(), err)
+// NewWithEnv 创建独立的审计对象 不依赖全局的 WithEnv
+func NewWithEnv(env Env) *Audit {
+	adt := New()
+	adt.env = env
+	return adt
+}
+
+func (a *Audit) config() *config {
+	return a.cfg.Load()
+}
+
+// reload 原子替换配置 处理中的事件继续使用旧的配置
+// 文件路径变化时才重新打开 限速计数 聚合队列和spool 保存在 Audit 上不受影响
+func (a *Audit) reload(cfg *config) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	//新克隆的虚拟机还没有被使用 直接关闭 沿用之前的 每次 audit.new{} 不会多出一个 LState
+	if cur := a.config().co; cur != nil && cfg.co != nil && cur != cfg.co {
+		cfg.co.close()
+		cfg.co = cur
+	}
+
+	old := a.cfg.Swap(cfg)
+	a.mem.limit(cfg.maxKeys)
+	if !a.IsRun() {
 		return
 	}
 
+	if old.file != cfg.file {
+		a.swapFile(a.openFile(cfg.file))
+	}
+
+	if old.store != cfg.store || old.retention != cfg.retention {
+		a.openStore(cfg)
+	}
+
+	if old.metrics != cfg.metrics {
+		a.serveMetrics(cfg.metrics)
+	}
+
+	if old.ack != cfg.ack || old.spool != cfg.spool {
+		if err := a.dlv.open(cfg.ack, cfg.spool, a.environ().Now()); err != nil {
+			a.environ().Errorf("%s open ack index fail %v", cfg.name, err)
+		}
+	}
+}
+
+// update 写时复制 运行时修改配置不会影响正在读取旧配置的 handle
+func (a *Audit) update(fn func(cfg *config)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cfg := a.config().clone()
+	fn(cfg)
+	a.cfg.Store(cfg)
+}
+
+func (a *Audit) environ() Env {
+	if a.env == nil {
+		return defaultEnv
+	}
+	return a.env
+}
+
+func (a *Audit) openFile(path string) *os.File {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
+	if err != nil {
+		a.environ().Errorf("%s open file error %v", a.Name(), err)
+		return nil
+	}
+
+	return fd
+}
+
+// swapFile 替换输出文件 旧文件在没有写入的时候关闭
+func (a *Audit) swapFile(fd *os.File) {
+	a.fmu.Lock()
+	old := a.fd
 	a.fd = fd
+	a.fmu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
 }
 
-func (a *Audit) output(ev *Event) {
-	if a.cfg.sdk != nil {
-		a.cfg.sdk.Write(ev.Byte())
+func (a *Audit) openStore(cfg *config) {
+	if err := a.db.open(cfg.store, cfg.retention); err != nil {
+		a.environ().Errorf("%s open event store fail %v", cfg.name, err)
+	}
+}
+
+func (a *Audit) output(ev *Event, cfg *config) {
+	if err := a.db.append(ev); err != nil {
+		a.environ().Errorf("%s event store write fail %v", cfg.name, err)
+	}
+
+	a.fmu.RLock()
+	defer a.fmu.RUnlock()
+
+	if cfg.sdk == nil && a.fd == nil {
+		return
+	}
+
+	raw := ev.encode(cfg.format, cfg.schema)
+	if cfg.sdk != nil {
+		cfg.sdk.Write(raw)
 	}
 
 	if a.fd != nil {
-		a.fd.Write(ev.Byte())
-		a.fd.Write([]byte("\n"))
+		n, _ := a.fd.Write(append(raw, '\n'))
+		atomic.AddUint64(&a.written, uint64(n))
 	}
 }
 
-func (a *Audit) pass(ev *Event) bool {
-	n := len(a.cfg.pass)
+func (a *Audit) pass(ev *Event, cfg *config) bool {
+	if a.hook.match(ev) {
+		return true
+	}
+
+	n := len(cfg.pass)
 	if n == 0 {
 		return false
 	}
 
 	for i := 0; i < n; i++ {
-		if a.cfg.pass[i](ev) {
+		if cfg.pass[i](ev) {
 			return true
 		}
 	}
@@ -69,54 +195,152 @@ func (a *Audit) pass(ev *Event) bool {
 	return false
 }
 
-func (a *Audit) inhibit(ev *Event) {
+func (a *Audit) inhibit(ev *Event, cfg *config) {
 	if !ev.alert {
 		return
 	}
 
-	n := len(a.cfg.rate)
+	n := len(cfg.rate)
 	if n == 0 {
 		return
 	}
 
+	if a.never(ev, cfg) {
+		return
+	}
+
+	db := a.bucket(cfg)
 	for i := 0; i < n; i++ {
-		if a.cfg.rate[i](a.cfg.bkt, ev) {
+		r := cfg.rate[i]
+		if !r.scope(ev) {
+			continue
+		}
+
+		count, ok := r.match(db, a.track, ev)
+		if !ok {
+			continue
+		}
+
+		if !r.escalated(ev, count) {
 			ev.alert = false
-			return
+		}
+		return
+	}
+}
+
+// Put 提交事件到当前审计对象
+// 先登记 inflight 再检查 closing Close 看到 inflight 为0之后不会再有事件进入 handle
+func (a *Audit) Put(ev *Event) {
+	atomic.AddInt64(&a.inflight, 1)
+	defer atomic.AddInt64(&a.inflight, -1)
+
+	if atomic.LoadInt32(&a.closing) == 1 {
+		a.stat.incr(ev, mDropped)
+		return
+	}
+
+	a.stat.incr(ev, mPut)
+	ev.adt = a
+	a.limit(ev, a.config())
+	ev.upload = true
+	a.handle(ev)
+}
+
+// NewEvent 创建绑定到当前审计对象的事件 节点信息来自审计对象的环境
+func (a *Audit) NewEvent(typeof string, opts ...func(*Event)) *Event {
+	env := a.environ()
+	now := env.Now()
+	ev := &Event{
+		adt:    a,
+		uid:    eventID.next(now),
+		id:     env.ID(),
+		inet:   env.LocalAddr(),
+		time:   now,
+		level:  SeverityInfo,
+		typeof: typeof,
+	}
+
+	for _, fn := range opts {
+		fn(ev)
+	}
+	return ev
+}
+
+// never 不做限速的等级
+func (a *Audit) never(ev *Event, cfg *config) bool {
+	for _, lv := range cfg.never {
+		if lv == ev.level {
+			return true
 		}
 	}
+	return false
 }
 
 func (a *Audit) handle(ev *Event) {
+	env := a.environ()
+	cfg := a.config()
+	defer a.stat.observe(ev, time.Now())
 
-	a.output(ev)
+	//事件聚合
+	if !ev.rolled {
+		merged, due := a.roll.add(cfg.rollup, ev, env.Now())
+		if due != nil {
+			a.handle(due)
+		}
 
-	if a.pass(ev) {
-		xEnv.Debugf("by pass ev %s %s %s", ev.from, ev.typeof, ev.msg)
+		if merged {
+			a.stat.incr(ev, mRolled)
+			return
+		}
+	}
+
+	//采样
+	if !a.sample(ev, cfg) {
+		a.stat.incr(ev, mSampled)
+		env.Debugf("sample drop ev %s %s %s", ev.from, ev.typeof, ev.msg)
+		return
+	}
+
+	a.output(ev, cfg)
+
+	//sink 在 handle 结束时收到拷贝 之后的限速 流处理不会再修改它们拿到的事件
+	defer a.hook.write(ev, a.E)
+
+	if a.pass(ev, cfg) {
+		a.stat.incr(ev, mBypass)
+		env.Debugf("by pass ev %s %s %s", ev.from, ev.typeof, ev.msg)
 		return
 	}
 
 	//告警限速
-	if ev.alert && !xEnv.IsDebug() {
-		a.inhibit(ev)
+	if ev.alert && !env.IsDebug() {
+		a.inhibit(ev, cfg)
+		if !ev.alert {
+			a.stat.incr(ev, mInhibited)
+		}
 	}
 
 	//流处理
-	a.cfg.pipe.Do(ev, a.cfg.co, func(err error) {
-		xEnv.Errorf("%v", err)
-	})
+	if len(cfg.pipe) > 0 {
+		cfg.co.do(func(co *lua.LState) {
+			for _, px := range cfg.pipe {
+				px.Do(ev, co, func(err error) {
+					env.Errorf("%v", err)
+				})
+			}
+		})
+	}
 
 	//是否上传
 	if !ev.upload {
 		return
 	}
 
-	err := xEnv.TnlSend(opcode.OpEvent, json.RawMessage(ev.Byte()))
+	err := a.dlv.send(env, ev.uid, ev.Byte())
 	if err != nil {
-		xEnv.Errorf("%s tnl send event fail %v", xEnv.TnlName(), err)
+		a.stat.incr(ev, mFailed)
+		env.Errorf("tnl send event fail %v", err)
 		return
 	}
-
-	//xEnv.Debugf("%s tnl send %v event succeed", xEnv.TnlName(), ev)
-
+	a.stat.incr(ev, mUploaded)
 }
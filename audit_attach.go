@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const msgLimit = 4096
+
+// limitFields 可以配置长度限制的字段 attr 对每个附加属性的值生效
+var limitFields = []string{"msg", "subject", "user", "auth", "from", "attr"}
+
+func checkLimitField(key string) bool {
+	for _, f := range limitFields {
+		if f == key {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate 按照utf8边界截断 不会切断多字节字符
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// limit 超长的字段截断 msg 的完整内容保存到附件 事件中记录 msg_ref
+func (a *Audit) limit(ev *Event, cfg *config) {
+	for key, n := range cfg.limits {
+		switch key {
+		case "msg":
+			if n <= 0 || len(ev.msg) <= n {
+				continue
+			}
+
+			ev.size = len(ev.msg)
+			if cfg.attach != "" {
+				ref, err := writeAttachment(cfg.attach, []byte(ev.msg), a.environ().Now())
+				if err != nil {
+					a.environ().Errorf("%s save msg attachment fail %v", cfg.name, err)
+				} else {
+					ev.ref = ref
+				}
+			}
+			ev.msg = truncate(ev.msg, n)
+
+		case "subject":
+			ev.subject = truncate(ev.subject, n)
+		case "user":
+			ev.user = truncate(ev.user, n)
+		case "auth":
+			ev.auth = truncate(ev.auth, n)
+		case "from":
+			ev.from = truncate(ev.from, n)
+		case "attr":
+			for i := range ev.attrs {
+				ev.attrs[i].val = truncate(ev.attrs[i].val, n)
+			}
+		}
+	}
+}
+
+func checkRef(ref string) error {
+	if len(ref) != sha256.Size*2 {
+		return fmt.Errorf("invalid attachment ref %s", ref)
+	}
+
+	if _, err := hex.DecodeString(ref); err != nil {
+		return fmt.Errorf("invalid attachment ref %s", ref)
+	}
+	return nil
+}
+
+// attachPath 按照前两位分目录 避免单个目录文件过多
+func attachPath(dir, ref string) string {
+	return filepath.Join(dir, ref[:2], ref)
+}
+
+// writeAttachment 内容寻址 相同的内容只保存一份
+// 修改时间使用 Env 的时钟 和 expireAttachment 使用同一个时间
+func writeAttachment(dir string, data []byte, now time.Time) (string, error) {
+	sum := sha256.Sum256(data)
+	ref := hex.EncodeToString(sum[:])
+	path := attachPath(dir, ref)
+
+	if _, err := os.Stat(path); err == nil {
+		os.Chtimes(path, now, now)
+		return ref, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+
+	//并发写入相同内容时 每个写入使用自己的临时文件 rename 是原子的
+	tmp, err := os.CreateTemp(filepath.Dir(path), ref+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmp.Write(data)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), now, now)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return ref, nil
+}
+
+// ReadAttachment 读取附件并校验sha256 离线工具可以直接使用
+func ReadAttachment(dir, ref string) ([]byte, error) {
+	ref = strings.ToLower(ref)
+	if err := checkRef(ref); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(attachPath(dir, ref))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != ref {
+		return nil, fmt.Errorf("attachment %s checksum mismatch", ref)
+	}
+	return data, nil
+}
+
+// Attachment 按照 msg_ref 读取完整的消息
+func (a *Audit) Attachment(ref string) ([]byte, error) {
+	cfg := a.config()
+	if cfg.attach == "" {
+		return nil, fmt.Errorf("attachment store not enabled")
+	}
+	return ReadAttachment(cfg.attach, ref)
+}
+
+// expireAttachment 删除超过保留天数没有再次写入的附件
+func expireAttachment(dir string, retention int, now time.Time) {
+	if dir == "" || retention <= 0 {
+		return
+	}
+
+	edge := now.AddDate(0, 0, -retention)
+	subs, _ := os.ReadDir(dir)
+	for _, sub := range subs {
+		if !sub.IsDir() {
+			continue
+		}
+
+		base := filepath.Join(dir, sub.Name())
+		files, _ := os.ReadDir(base)
+		for _, f := range files {
+			info, err := f.Info()
+			if err == nil && info.ModTime().Before(edge) {
+				os.Remove(filepath.Join(base, f.Name()))
+			}
+		}
+	}
+}
+
+// MsgRef 完整消息的附件引用 没有截断时为空
+func (ev *Event) MsgRef() string {
+	return ev.ref
+}
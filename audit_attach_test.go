@@ -0,0 +1,73 @@
+package audit_test
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttachConcurrent(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	dir := t.TempDir()
+	adt.UseAttach(dir)
+
+	msg := strings.Repeat("a", 8192)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			adt.NewEvent("big").Msg("%s", msg).Put()
+		}()
+	}
+	wg.Wait()
+
+	evs := rec.Events()
+	if len(evs) != 8 {
+		t.Fatalf("expect 8 events , got %d", len(evs))
+	}
+
+	for _, ev := range evs {
+		body, err := adt.Attachment(ev.MsgRef())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != msg {
+			t.Fatalf("expect full msg , got %d bytes", len(body))
+		}
+	}
+
+	tmp, _ := filepath.Glob(filepath.Join(dir, "*", "*.tmp"))
+	if len(tmp) != 0 {
+		t.Fatalf("expect no temp files , got %v", tmp)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if len(files) != 1 {
+		t.Fatalf("expect one attachment , got %v", files)
+	}
+}
+
+// 附件的修改时间和过期都使用注入的时钟
+func TestAttachExpireWithClock(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	dir := t.TempDir()
+	adt.UseAttach(dir)
+
+	adt.NewEvent("big").Msg("%s", strings.Repeat("b", 8192)).Put()
+	ref := rec.ExpectEvent(t, "big").MsgRef()
+
+	env.Clock.Advance(6 * 24 * time.Hour)
+	adt.ExpireAttachment()
+	if _, err := adt.Attachment(ref); err != nil {
+		t.Fatalf("expect attachment kept within retention , got %v", err)
+	}
+
+	env.Clock.Advance(2 * 24 * time.Hour)
+	adt.ExpireAttachment()
+	if _, err := adt.Attachment(ref); err == nil {
+		t.Fatal("expect attachment expired after retention")
+	}
+}
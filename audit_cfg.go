@@ -1,36 +1,104 @@
 package audit
 
 import (
+	"fmt"
 	"github.com/vela-security/vela-public/auxlib"
 	"github.com/vela-security/vela-public/lua"
 	"github.com/vela-security/vela-public/pipe"
+	"sync"
 )
 
 type config struct {
-	name string
-	bkt  []string
-	rate []inhibitMatch
-	pass []match
-	file string
-	pipe *pipe.Px
-	sdk  lua.Writer
-	co   *lua.LState
+	name   string
+	bkt    []string
+	rate   []*inhibitRule
+	never  []Severity
+	rollup []*rollupRule
+	sample []*sampleRule
+	pass   []match
+	file   string
+	pipe   []*pipe.Px
+	sdk    lua.Writer
+	co     *coroutine
+
+	format string
+	schema *schema
+
+	ack         string
+	spool       string
+	inhibitFile string
+	deadline    int
+	heartbeat   int
+	metrics     string
+	backend     string
+	maxKeys     int
+	store       string
+	retention   int
+	attach      string
+	attachDays  int
+	limits      map[string]int
+}
+
+// coroutine pipe 使用的lua虚拟机 LState 不是并发安全的 多个 handle 串行使用
+// clone 之后的配置共享同一个 coroutine 重新加载时沿用 关闭审计对象时释放
+type coroutine struct {
+	mu     sync.Mutex
+	co     *lua.LState
+	closed bool
+}
+
+func (c *coroutine) do(fn func(co *lua.LState)) {
+	if c == nil {
+		fn(nil)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	fn(c.co)
+}
+
+// close 等待正在执行的 pipe 结束之后关闭虚拟机 之后的 do 不再执行
+func (c *coroutine) close() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed && c.co != nil {
+		c.co.Close()
+	}
+	c.closed = true
 }
 
 func velaMinConfig() *config {
 	return &config{
-		name: "vela.audit",
-		file: "vela.audit.log",
-		pipe: pipe.New(),
-		bkt:  []string{"audit_inhibit_record"},
-		rate: []inhibitMatch{newInhibitMatch("$inet_$id_$typeof_$from", 5*60)},
+		name:        "vela.audit",
+		file:        "vela.audit.log",
+		ack:         "vela.audit.ack",
+		spool:       "vela.audit.spool",
+		inhibitFile: "vela.audit.inhibit",
+		deadline:    5,
+		format:      FormatVela,
+		backend:     BackendBucket,
+		maxKeys:     memMaxKeys,
+		retention:   7,
+		attachDays:  7,
+		limits:      map[string]int{"msg": msgLimit},
+		schema:      defaultSchema.clone(),
+		bkt:         []string{"audit_inhibit_record"},
+		rate:        []*inhibitRule{newInhibitRule("$inet_$id_$typeof_$from", 5*60)},
 	}
 }
 
 func newConfig(L *lua.LState) *config {
 	tab := L.CheckTable(1)
 	cfg := velaMinConfig()
-	cfg.co = xEnv.Clone(L)
+	cfg.co = &coroutine{co: xEnv.Clone(L)}
 
 	tab.Range(func(key string, val lua.LValue) {
 		switch key {
@@ -41,6 +109,68 @@ func newConfig(L *lua.LState) *config {
 		case "to":
 			cfg.sdk = auxlib.CheckWriter(val, L)
 
+		case "ack":
+			cfg.ack = val.String()
+
+		case "spool":
+			cfg.spool = val.String()
+
+		case "inhibit_file":
+			cfg.inhibitFile = val.String()
+
+		case "store":
+			cfg.store = val.String()
+
+		case "retention":
+			cfg.retention = lua.IsInt(val)
+
+		case "attachment":
+			cfg.attach = val.String()
+
+		case "attachment_retention":
+			cfg.attachDays = lua.IsInt(val)
+
+		case "limits":
+			checkTable(L, key, val).Range(func(field string, lv lua.LValue) {
+				if !checkLimitField(field) {
+					L.RaiseError("invalid limits field %s , must be %v", field, limitFields)
+					return
+				}
+				cfg.limits[field] = lua.IsInt(lv)
+			})
+
+		case "metrics":
+			cfg.metrics = val.String()
+
+		case "heartbeat":
+			cfg.heartbeat = lua.IsInt(val)
+
+		case "deadline":
+			cfg.deadline = lua.IsInt(val)
+
+		case "format":
+			cfg.format = val.String()
+
+		case "backend":
+			cfg.backend = val.String()
+
+		case "inhibit_keys":
+			cfg.maxKeys = lua.IsInt(val)
+
+		case "never_inhibit":
+			checkTable(L, key, val).Range(func(_ string, lv lua.LValue) {
+				cfg.never = append(cfg.never, checkSeverity(L, lv.String()))
+			})
+
+		case "ecs":
+			cfg.schema.ecsL(checkTable(L, key, val))
+
+		case "ocsf":
+			cfg.schema.ocsfL(checkTable(L, key, val))
+
+		case "labels":
+			cfg.schema.labelsL(L, val)
+
 		default:
 			L.RaiseError("not found %s", key)
 		}
@@ -55,6 +185,45 @@ func newConfig(L *lua.LState) *config {
 	return cfg
 }
 
+// clone 浅拷贝配置 规则本身不可变 只需要复制切片
+func (cfg *config) clone() *config {
+	c := *cfg
+	c.bkt = append([]string(nil), cfg.bkt...)
+	c.rate = append([]*inhibitRule(nil), cfg.rate...)
+	c.never = append([]Severity(nil), cfg.never...)
+	c.rollup = append([]*rollupRule(nil), cfg.rollup...)
+	c.sample = append([]*sampleRule(nil), cfg.sample...)
+	c.pass = append([]match(nil), cfg.pass...)
+	c.pipe = append([]*pipe.Px(nil), cfg.pipe...)
+	c.limits = make(map[string]int, len(cfg.limits))
+	for k, v := range cfg.limits {
+		c.limits[k] = v
+	}
+	return &c
+}
+
 func (cfg *config) verify() error {
+	if !checkFormat(cfg.format) {
+		return fmt.Errorf("invalid format %s , must be vela , ecs or ocsf", cfg.format)
+	}
+
+	switch cfg.backend {
+	case BackendBucket, BackendMemory:
+	default:
+		return fmt.Errorf("invalid backend %s , must be bucket or memory", cfg.backend)
+	}
+
+	if cfg.maxKeys <= 0 {
+		return fmt.Errorf("invalid inhibit_keys %d", cfg.maxKeys)
+	}
 	return nil
 }
+
+func checkTable(L *lua.LState, key string, val lua.LValue) *lua.LTable {
+	tab, ok := val.(*lua.LTable)
+	if !ok {
+		L.RaiseError("%s must be table , got %s", key, val.Type().String())
+		return &lua.LTable{}
+	}
+	return tab
+}
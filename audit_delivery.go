@@ -0,0 +1,394 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ackRetention = 24 * time.Hour
+	spoolMaxSize = 64 * 1024 * 1024
+	retryPeriod  = 30 * time.Second
+)
+
+// DedupKey 上游去重使用的key 同一个事件重试或者重放时保持不变
+func (ev *Event) DedupKey() string {
+	h := sha1.New()
+	h.Write([]byte(ev.id))
+	h.Write([]byte{'/'})
+	h.Write([]byte(ev.uid))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ulidTime ULID 前10位是毫秒时间戳
+func ulidTime(id string) (time.Time, bool) {
+	if len(id) != 26 {
+		return time.Time{}, false
+	}
+
+	var ms uint64
+	for i := 0; i < 10; i++ {
+		idx := strings.IndexByte(crockford, id[i])
+		if idx < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | uint64(idx)
+	}
+	return time.UnixMilli(int64(ms)), true
+}
+
+// delivery 至少一次的上传 已确认的事件ID记录在本地索引中
+// 上传失败的事件写入spool 后台重试 重启之后不会再次上传已确认的事件
+type delivery struct {
+	mu      sync.Mutex
+	acked   map[string]struct{}
+	ackFd   *os.File
+	ackPath string
+	ackLine int
+
+	//smu 保护spool文件 只在读取快照和重写时持有 加锁顺序 rmu -> smu -> mu
+	//rmu 同一时间只有一个重试
+	rmu       sync.Mutex
+	smu       sync.Mutex
+	spoolPath string
+	spoolSize int64
+	dropped   uint64
+	dropping  bool
+}
+
+func newDelivery() *delivery {
+	return &delivery{acked: make(map[string]struct{})}
+}
+
+// open 加载确认索引 过期的ID会在重写时丢弃
+func (d *delivery) open(ackPath, spoolPath string, now time.Time) error {
+	d.smu.Lock()
+	d.spoolPath = spoolPath
+	d.spoolSize = 0
+	if st, err := os.Stat(spoolPath); err == nil {
+		d.spoolSize = st.Size()
+	}
+	d.smu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ackPath == "" || ackPath == d.ackPath {
+		return nil
+	}
+
+	d.closeAck()
+	d.ackPath = ackPath
+	if fd, err := os.Open(ackPath); err == nil {
+		sc := bufio.NewScanner(fd)
+		for sc.Scan() {
+			id := sc.Text()
+			if tm, ok := ulidTime(id); ok && now.Sub(tm) < ackRetention {
+				d.acked[id] = struct{}{}
+			}
+		}
+		fd.Close()
+	}
+
+	return d.compact()
+}
+
+// compact 只保留有效期内的ID 重写索引文件
+func (d *delivery) compact() error {
+	tmp := d.ackPath + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(fd)
+	for id := range d.acked {
+		w.WriteString(id)
+		w.WriteByte('\n')
+	}
+
+	if err = w.Flush(); err != nil {
+		fd.Close()
+		return err
+	}
+	fd.Close()
+
+	if err = os.Rename(tmp, d.ackPath); err != nil {
+		return err
+	}
+
+	d.closeAck()
+	d.ackFd, err = os.OpenFile(d.ackPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	d.ackLine = len(d.acked)
+	return err
+}
+
+func (d *delivery) closeAck() {
+	if d.ackFd != nil {
+		d.ackFd.Close()
+		d.ackFd = nil
+	}
+}
+
+func (d *delivery) isAcked(uid string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.acked[uid]
+	return ok
+}
+
+func (d *delivery) ack(uid string) {
+	if uid == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.acked[uid] = struct{}{}
+	if d.ackFd == nil {
+		return
+	}
+
+	d.ackFd.WriteString(uid + "\n")
+	d.ackLine++
+}
+
+// expire 清理过期的ID 索引文件膨胀一倍以上时重写
+func (d *delivery) expire(now time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id := range d.acked {
+		if tm, ok := ulidTime(id); !ok || now.Sub(tm) >= ackRetention {
+			delete(d.acked, id)
+		}
+	}
+
+	if d.ackFd == nil || d.ackLine < 2*len(d.acked)+1024 {
+		return nil
+	}
+	return d.compact()
+}
+
+// spool 追加到spool文件 没有启动 , 超过 spoolMaxSize 或者写入失败时丢弃
+// 连续丢弃只记录第一次 写入成功之后再次丢弃会重新记录
+func (d *delivery) spool(env Env, raw []byte) {
+	d.smu.Lock()
+	defer d.smu.Unlock()
+
+	var err error
+	switch {
+	case d.spoolPath == "":
+		err = fmt.Errorf("spool not open , audit not started")
+	case d.spoolSize+int64(len(raw))+1 > spoolMaxSize:
+		err = fmt.Errorf("spool %s reach %d bytes", d.spoolPath, spoolMaxSize)
+	default:
+		err = d.appendSpool(raw)
+	}
+
+	if err == nil {
+		d.dropping = false
+		return
+	}
+
+	d.dropped++
+	if !d.dropping {
+		d.dropping = true
+		env.Errorf("audit upload fail and %v , event dropped", err)
+	}
+}
+
+func (d *delivery) appendSpool(raw []byte) error {
+	fd, err := os.OpenFile(d.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	n, err := fd.Write(append(raw, '\n'))
+	d.spoolSize += int64(n)
+	return err
+}
+
+// send 已经确认的事件直接跳过 发送失败写入spool
+func (d *delivery) send(env Env, uid string, raw []byte) error {
+	if uid != "" && d.isAcked(uid) {
+		return nil
+	}
+
+	if err := env.TnlSend(raw); err != nil {
+		d.spool(env, raw)
+		return err
+	}
+
+	d.ack(uid)
+	return nil
+}
+
+type spoolHead struct {
+	EventID string `json:"event_id"`
+}
+
+// retry 重新发送spool中未确认的事件 失败的保留到下一次
+// 发送期间不持有 smu handle 中的 spool 追加不会被阻塞 重写时保留发送期间追加的内容
+func (d *delivery) retry(env Env) (int, error) {
+	d.rmu.Lock()
+	defer d.rmu.Unlock()
+
+	d.smu.Lock()
+	path := d.spoolPath
+	if path == "" {
+		d.smu.Unlock()
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	d.smu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var keep [][]byte
+	var sent int
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var head spoolHead
+		json.Unmarshal(line, &head)
+		if head.EventID != "" && d.isAcked(head.EventID) {
+			continue
+		}
+
+		if len(keep) == 0 {
+			if e := env.TnlSend(line); e == nil {
+				d.ack(head.EventID)
+				sent++
+				continue
+			}
+		}
+
+		//通道还没有恢复 剩下的保留到下一次
+		keep = append(keep, line)
+	}
+
+	d.smu.Lock()
+	defer d.smu.Unlock()
+
+	//发送期间追加的事件在快照之后
+	tail, err := readFrom(path, int64(len(data)))
+	if err != nil {
+		return sent, err
+	}
+
+	if len(keep) == 0 && len(tail) == 0 {
+		if path == d.spoolPath {
+			d.spoolSize = 0
+		}
+		return sent, os.Remove(path)
+	}
+
+	var body []byte
+	if len(keep) > 0 {
+		body = append(bytes.Join(keep, []byte("\n")), '\n')
+	}
+	body = append(body, tail...)
+
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, body, 0600); err != nil {
+		return sent, err
+	}
+
+	if path == d.spoolPath {
+		d.spoolSize = int64(len(body))
+	}
+	return sent, os.Rename(tmp, path)
+}
+
+// readFrom 读取文件offset之后的内容 文件不存在时返回空
+func readFrom(path string, offset int64) ([]byte, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fd.Close()
+
+	if _, err = fd.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(fd)
+}
+
+func (d *delivery) size() int64 {
+	d.smu.Lock()
+	defer d.smu.Unlock()
+	return d.spoolSize
+}
+
+// droppedCount 上传失败并且没有写入spool的事件数
+func (d *delivery) droppedCount() uint64 {
+	d.smu.Lock()
+	defer d.smu.Unlock()
+	return d.dropped
+}
+
+func (d *delivery) close() {
+	d.smu.Lock()
+	d.spoolPath = ""
+	d.smu.Unlock()
+
+	d.mu.Lock()
+	d.closeAck()
+	d.ackPath = ""
+	d.mu.Unlock()
+}
+
+func (a *Audit) retryLoop(stop chan struct{}) {
+	tk := time.NewTicker(retryPeriod)
+	defer tk.Stop()
+
+	var swept time.Time
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C:
+			env := a.environ()
+			if n, err := a.dlv.retry(env); err != nil {
+				env.Errorf("audit spool retry fail %v", err)
+			} else if n > 0 {
+				env.Debugf("audit spool retry %d event succeed", n)
+			}
+
+			if err := a.dlv.expire(env.Now()); err != nil {
+				env.Errorf("audit ack index compact fail %v", err)
+			}
+			a.db.expire()
+
+			//附件目录需要逐个检查 每小时一次
+			if now := env.Now(); now.Sub(swept) >= time.Hour {
+				cfg := a.config()
+				expireAttachment(cfg.attach, cfg.attachDays, now)
+				swept = now
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package audit_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestDeliverySpoolRetry(t *testing.T) {
+	adt, env, _ := newAudit(t)
+	start(t, adt)
+
+	env.Tunnel.Fail(errors.New("tunnel down"))
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("login").Subject("登录失败").Put()
+	}
+
+	if st := adt.Stats(); st.Failed != 3 {
+		t.Fatalf("expect 3 failed , got %d", st.Failed)
+	}
+	if adt.SpoolSize() == 0 {
+		t.Fatal("expect failed event in spool")
+	}
+
+	//通道没有恢复 保留到下一次
+	if n, err := adt.RetrySpool(); err != nil || n != 0 {
+		t.Fatalf("expect retry send nothing , got %d %v", n, err)
+	}
+
+	env.Tunnel.Fail(nil)
+	n, err := adt.RetrySpool()
+	if err != nil || n != 3 {
+		t.Fatalf("expect retry send 3 , got %d %v", n, err)
+	}
+	if adt.SpoolSize() != 0 {
+		t.Fatalf("expect empty spool , got %d", adt.SpoolSize())
+	}
+
+	sent := env.Tunnel.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("expect 3 upload , got %d", len(sent))
+	}
+
+	//已经确认的事件重放时不会再次上传
+	ev, err := audit.DecodeEvent(sent[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	adt.Put(ev)
+
+	if got := len(env.Tunnel.Sent()); got != 3 {
+		t.Fatalf("expect acked event skipped , got %d upload", got)
+	}
+	env.Tunnel.ExpectUpload(t, "login")
+}
+
+func TestDeliveryDedupKey(t *testing.T) {
+	adt, env, _ := newAudit(t)
+
+	adt.NewEvent("login").Put()
+	up := env.Tunnel.ExpectUpload(t, "login")
+
+	ev, err := audit.DecodeEvent(env.Tunnel.Sent()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if up["dedup_key"] != ev.DedupKey() {
+		t.Fatalf("expect dedup_key %s , got %v", ev.DedupKey(), up["dedup_key"])
+	}
+}
+
+// 没有启动时 spool 还没有打开 上传失败的事件计入 spool_dropped 只记录一次日志
+func TestDeliveryDropBeforeStart(t *testing.T) {
+	adt, env, _ := newAudit(t)
+
+	env.Tunnel.Fail(errors.New("tunnel down"))
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("login").Put()
+	}
+
+	if st := adt.Stats(); st.Failed != 3 || st.SpoolDropped != 3 {
+		t.Fatalf("expect 3 failed 3 spool dropped , got %d %d", st.Failed, st.SpoolDropped)
+	}
+
+	logged := 0
+	for _, e := range env.Errors() {
+		if strings.Contains(e, "event dropped") {
+			logged++
+		}
+	}
+	if logged != 1 {
+		t.Fatalf("expect drop logged once , got %d %v", logged, env.Errors())
+	}
+}
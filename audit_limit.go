@@ -2,7 +2,14 @@ package audit
 
 import "github.com/vela-security/vela-public/auxlib"
 
-type inhibitMatch func([]string, *Event) bool // ev.a .. ev.bb ..ev.cc ..ev.dd / 500
+// inhibitRule ev.a .. ev.bb ..ev.cc ..ev.dd / 500
+type inhibitRule struct {
+	tag      string
+	ttl      int
+	inh      *inhibit
+	when     match //为空作用于所有告警
+	escalate int   //连续抑制次数达到escalate 升级等级并放行
+}
 
 type inhibit struct {
 	offset int
@@ -86,7 +93,7 @@ func (inh *inhibit) compile() {
 		switch inh.tag[idx : idx+6] {
 		case "$level":
 			inh.append(func(ev *Event) string {
-				return ev.level
+				return ev.level.Label(LangZH)
 			})
 			idx += 6
 			inh.Offset(idx)
@@ -191,27 +198,51 @@ func (inh *inhibit) Key(ev *Event) string {
 	return auxlib.B2S(buf)
 }
 
-//newInhibitMatch helo.$id.$inet.$bb.xx => helo.id1.192.179.1.1.vela.cc
-func newInhibitMatch(tag string, ttl int) inhibitMatch {
+//newInhibitRule helo.$id.$inet.$bb.xx => helo.id1.192.179.1.1.vela.cc
+func newInhibitRule(tag string, ttl int) *inhibitRule {
 	inh := newInhibit(tag)
 	inh.compile()
+	return &inhibitRule{tag: tag, ttl: ttl, inh: inh}
+}
 
-	return func(bkt []string, ev *Event) bool {
-		if len(bkt) == 0 {
-			return false
-		}
+func (r *inhibitRule) Key(ev *Event) string {
+	return r.inh.Key(ev)
+}
 
-		db := xEnv.Bucket(bkt...)
-		key := inh.Key(ev)
-		count, err := db.Incr(key, 1, ttl)
-		if err != nil {
-			xEnv.Errorf("%v incr %s fail %v", bkt, count, err)
-			return false
-		}
+func (r *inhibitRule) scope(ev *Event) bool {
+	if r.when == nil {
+		return true
+	}
+	return r.when(ev)
+}
 
-		if count >= 1 {
-			return true
-		}
+// match 返回已经抑制的次数和是否需要抑制 同时记录到track
+func (r *inhibitRule) match(db Bucket, tk *inhibitTrack, ev *Event) (int, bool) {
+	key := r.Key(ev)
+	count, err := db.Incr(key, 1, r.ttl)
+	if err != nil {
+		return 0, false
+	}
+
+	tk.touch(r, key, count)
+	if count >= 1 {
+		return count, true
+	}
+	return 0, false
+}
+
+// escalates 已经抑制count次时 这一条是否放行
+func (r *inhibitRule) escalates(count int) bool {
+	return r.escalate > 0 && count%r.escalate == 0
+}
+
+// escalated 每抑制escalate次放行一次 并提升一个等级
+func (r *inhibitRule) escalated(ev *Event, count int) bool {
+	if !r.escalates(count) {
 		return false
 	}
+
+	ev.raise()
+	ev.Attr("inhibited", count)
+	return true
 }
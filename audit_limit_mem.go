@@ -0,0 +1,303 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BackendBucket = "bucket"
+	BackendMemory = "memory"
+
+	memShards  = 32
+	memMaxKeys = 100000
+	memSweep   = 1024
+)
+
+// InhibitStats 内存限速存储的状态
+type InhibitStats struct {
+	Keys     int    `json:"keys"`
+	MaxKeys  int    `json:"max_keys"`
+	Expired  uint64 `json:"expired"`
+	Evicted  uint64 `json:"evicted"`
+	Fallback uint64 `json:"fallback"`
+}
+
+type memEntry struct {
+	count  int
+	expire int64
+}
+
+type memShard struct {
+	mu   sync.Mutex
+	data map[string]*memEntry
+	ops  int
+}
+
+// memStore 分片的内存计数存储 bucket不可用时作为兜底
+// 每个分片最多 max/memShards 个key 满了优先淘汰最早过期的key
+type memStore struct {
+	max      int64
+	keys     int64
+	expired  uint64
+	evicted  uint64
+	fallback uint64
+	down     int32 //bucket 不可用 只在状态变化时记录日志
+
+	now    func() time.Time
+	shards [memShards]memShard
+}
+
+func newMemStore(now func() time.Time) *memStore {
+	m := &memStore{now: now, max: memMaxKeys}
+	for i := range m.shards {
+		m.shards[i].data = make(map[string]*memEntry)
+	}
+	return m
+}
+
+func (m *memStore) shard(key string) *memShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &m.shards[h.Sum32()%memShards]
+}
+
+func (m *memStore) limit(n int) {
+	if n <= 0 {
+		n = memMaxKeys
+	}
+	atomic.StoreInt64(&m.max, int64(n))
+}
+
+// Incr 返回累加之前的值 过期或者新的key返回0
+func (m *memStore) Incr(key string, delta int, ttl int) (int, error) {
+	now := m.now().UnixNano()
+	s := m.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ops++
+	if s.ops%memSweep == 0 {
+		m.sweep(s, now)
+	}
+
+	e, ok := s.data[key]
+	if ok && e.expire > now {
+		prev := e.count
+		e.count += delta
+		return prev, nil
+	}
+
+	if !ok {
+		if len(s.data) >= int(atomic.LoadInt64(&m.max)/memShards)+1 {
+			m.evict(s, now)
+		}
+		atomic.AddInt64(&m.keys, 1)
+	}
+
+	s.data[key] = &memEntry{count: delta, expire: now + int64(ttl)*int64(time.Second)}
+	return 0, nil
+}
+
+// Count 当前计数 过期或者不存在的key返回0
+func (m *memStore) Count(key string) int {
+	now := m.now().UnixNano()
+	s := m.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[key]
+	if !ok || e.expire <= now {
+		return 0
+	}
+	return e.count
+}
+
+func (m *memStore) Delete(key string) error {
+	s := m.shard(key)
+	s.mu.Lock()
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		atomic.AddInt64(&m.keys, -1)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (m *memStore) sweep(s *memShard, now int64) {
+	for k, e := range s.data {
+		if e.expire <= now {
+			delete(s.data, k)
+			atomic.AddInt64(&m.keys, -1)
+			atomic.AddUint64(&m.expired, 1)
+		}
+	}
+}
+
+func (m *memStore) evict(s *memShard, now int64) {
+	m.sweep(s, now)
+	if len(s.data) < int(atomic.LoadInt64(&m.max)/memShards)+1 {
+		return
+	}
+
+	var key string
+	var min int64
+	for k, e := range s.data {
+		if key == "" || e.expire < min {
+			key = k
+			min = e.expire
+		}
+	}
+
+	delete(s.data, key)
+	atomic.AddInt64(&m.keys, -1)
+	atomic.AddUint64(&m.evicted, 1)
+}
+
+func (m *memStore) stats() InhibitStats {
+	return InhibitStats{
+		Keys:     int(atomic.LoadInt64(&m.keys)),
+		MaxKeys:  int(atomic.LoadInt64(&m.max)),
+		Expired:  atomic.LoadUint64(&m.expired),
+		Evicted:  atomic.LoadUint64(&m.evicted),
+		Fallback: atomic.LoadUint64(&m.fallback),
+	}
+}
+
+// fallbackBucket bucket incr 失败的时候切换到内存存储 避免告警泛滥
+type fallbackBucket struct {
+	env Env
+	bkt []string
+	db  Bucket
+	mem *memStore
+}
+
+func (f *fallbackBucket) Incr(key string, delta int, ttl int) (int, error) {
+	count, err := f.db.Incr(key, delta, ttl)
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&f.mem.down, 1, 0) {
+			f.env.Errorf("%v recovered , total fallback %d", f.bkt, atomic.LoadUint64(&f.mem.fallback))
+		}
+		return count, nil
+	}
+
+	if atomic.CompareAndSwapInt32(&f.mem.down, 0, 1) {
+		f.env.Errorf("%v incr %s fail %v , fallback to memory until it recovers", f.bkt, key, err)
+	}
+	atomic.AddUint64(&f.mem.fallback, 1)
+	return f.mem.Incr(key, delta, ttl)
+}
+
+func (f *fallbackBucket) Delete(key string) error {
+	f.mem.Delete(key)
+	if db, ok := f.db.(bucketDeleter); ok {
+		return db.Delete(key)
+	}
+	return nil
+}
+
+// Count bucket 不可用期间的计数在内存中 取两者中较大的
+func (f *fallbackBucket) Count(key string) int {
+	n := f.mem.Count(key)
+	if db, ok := f.db.(bucketCounter); ok {
+		if c := db.Count(key); c > n {
+			n = c
+		}
+	}
+	return n
+}
+
+func (a *Audit) bucket(cfg *config) Bucket {
+	if cfg.backend == BackendMemory || len(cfg.bkt) == 0 {
+		return a.mem
+	}
+
+	env := a.environ()
+	return &fallbackBucket{env: env, bkt: cfg.bkt, db: env.Bucket(cfg.bkt...), mem: a.mem}
+}
+
+// InhibitStats 内存限速存储的key数量 淘汰和兜底次数
+func (a *Audit) InhibitStats() InhibitStats {
+	return a.mem.stats()
+}
+
+type memRecord struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	Expire int64  `json:"expire"`
+}
+
+// dump 保存没有过期的计数 关闭审计对象时调用
+func (m *memStore) dump(path string) error {
+	now := m.now().UnixNano()
+	fd, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(fd)
+	enc := json.NewEncoder(w)
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		for k, e := range s.data {
+			if e.expire > now {
+				enc.Encode(memRecord{Key: k, Count: e.count, Expire: e.expire})
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	if err = w.Flush(); err != nil {
+		fd.Close()
+		return err
+	}
+	fd.Close()
+	return os.Rename(path+".tmp", path)
+}
+
+// restore 加载 dump 保存的计数 已经过期的忽略
+func (m *memStore) restore(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer fd.Close()
+
+	now := m.now().UnixNano()
+	dec := json.NewDecoder(bufio.NewReader(fd))
+	for {
+		var r memRecord
+		if err = dec.Decode(&r); err != nil {
+			break
+		}
+
+		if r.Expire <= now {
+			continue
+		}
+
+		s := m.shard(r.Key)
+		s.mu.Lock()
+		if _, ok := s.data[r.Key]; !ok {
+			atomic.AddInt64(&m.keys, 1)
+		}
+		s.data[r.Key] = &memEntry{count: r.Count, expire: r.Expire}
+		s.mu.Unlock()
+	}
+
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+	"github.com/vela-security/vela-audit/audittest"
+)
+
+func TestInhibitEscalate(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	if err := adt.SetInhibit("$typeof_$remote_addr", 60, "typeof = login", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func() {
+		adt.NewEvent("login").Remote("10.0.0.1").Subject("登录失败").Alert().Put()
+	}
+
+	//第一条正常告警 之后每抑制3次放行一次并提升等级
+	for i := 0; i < 5; i++ {
+		put()
+	}
+
+	evs := rec.Typeof("login")
+	if len(evs) != 5 {
+		t.Fatalf("expect 5 login event , got %d", len(evs))
+	}
+
+	want := []bool{true, false, false, true, false}
+	for i, ev := range evs {
+		if ev.IsAlert() != want[i] {
+			t.Fatalf("event %d expect alert %v , got %v", i, want[i], ev.IsAlert())
+		}
+	}
+
+	if evs[3].Severity() != audit.SeverityLow {
+		t.Fatalf("expect escalated severity low , got %s", evs[3].Severity())
+	}
+	if evs[3].Field("attr.inhibited") != "3" {
+		t.Fatalf("expect attr.inhibited 3 , got %q", evs[3].Field("attr.inhibited"))
+	}
+
+	if st := adt.Stats(); st.Inhibited != 3 {
+		t.Fatalf("expect 3 inhibited , got %d", st.Inhibited)
+	}
+
+	hits := adt.Explain(evs[0])
+	if len(hits) != 1 || hits[0].Count != 5 || !hits[0].Inhibit {
+		t.Fatalf("expect explain count 5 inhibit , got %+v", hits)
+	}
+
+	//再抑制一次之后 下一条达到escalate 会放行而不是抑制
+	put()
+	hits = adt.Explain(evs[0])
+	if len(hits) != 1 || hits[0].Count != 6 || hits[0].Inhibit || !hits[0].Escalate {
+		t.Fatalf("expect explain count 6 escalate , got %+v", hits)
+	}
+	rec.Reset()
+	put()
+	rec.ExpectAlert(t, "login")
+
+	//ttl 过期之后重新告警
+	env.Clock.Advance(61 * time.Second)
+	rec.Reset()
+	put()
+	rec.ExpectAlert(t, "login")
+}
+
+func TestInhibitScope(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	if err := adt.SetInhibit("$typeof", 60, "typeof = login", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("process").Alert().Put()
+	}
+
+	rec.ExpectCount(t, "process", 3)
+	for _, ev := range rec.Typeof("process") {
+		if !ev.IsAlert() {
+			t.Fatalf("process alert out of inhibit scope , got %s", ev.String())
+		}
+	}
+}
+
+func TestInhibitRelease(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	if err := adt.SetInhibit("$typeof", 60, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	adt.NewEvent("login").Alert().Put()
+	adt.NewEvent("login").Alert().Put()
+	if keys := adt.Inhibited(); len(keys) != 1 || keys[0].Key != "login" {
+		t.Fatalf("expect inhibited key login , got %+v", keys)
+	}
+
+	if err := adt.Release("login"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.Reset()
+	adt.NewEvent("login").Alert().Put()
+	rec.ExpectAlert(t, "login")
+}
+
+func TestInhibitReleaseWithoutDelete(t *testing.T) {
+	adt, _, rec := newAudit(t, audittest.WithIncrOnly())
+	if err := adt.SetInhibit("$typeof", 60, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	adt.NewEvent("login").Alert().Put()
+	adt.NewEvent("login").Alert().Put()
+
+	if err := adt.Release("login"); err == nil {
+		t.Fatal("expect error when bucket can not delete")
+	}
+
+	//bucket 中的计数还在 下一条告警仍然被抑制
+	rec.Reset()
+	adt.NewEvent("login").Alert().Put()
+	if ev := rec.ExpectEvent(t, "login"); ev.IsAlert() {
+		t.Fatal("expect alert still inhibited")
+	}
+}
@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InhibitKey 正在抑制告警的key
+type InhibitKey struct {
+	Key   string        `json:"key"`
+	Rule  string        `json:"rule"`
+	Count int           `json:"count"`
+	TTL   time.Duration `json:"ttl"`
+}
+
+// InhibitHit 事件命中的限速规则
+type InhibitHit struct {
+	Rule     string        `json:"rule"`
+	Key      string        `json:"key"`
+	Count    int           `json:"count"`
+	TTL      time.Duration `json:"ttl"`
+	Inhibit  bool          `json:"inhibit"`
+	Escalate bool          `json:"escalate"`
+}
+
+type trackEntry struct {
+	rule   string
+	count  int
+	expire time.Time
+}
+
+// inhibitTrack 记录本进程累加过的限速key
+// bucket 存储没有遍历接口 所以在这里维护一份用于查看和释放
+type inhibitTrack struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	data map[string]*trackEntry
+}
+
+func newInhibitTrack(now func() time.Time) *inhibitTrack {
+	return &inhibitTrack{now: now, data: make(map[string]*trackEntry)}
+}
+
+// touch count 是 Incr 返回的累加之前的值
+func (tk *inhibitTrack) touch(r *inhibitRule, key string, count int) {
+	now := tk.now()
+
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	e, ok := tk.data[key]
+	if !ok || count == 0 || !now.Before(e.expire) {
+		if !ok && len(tk.data) >= memMaxKeys {
+			tk.prune(now)
+		}
+		tk.data[key] = &trackEntry{rule: r.tag, count: count + 1, expire: now.Add(time.Duration(r.ttl) * time.Second)}
+		return
+	}
+	e.count = count + 1
+}
+
+func (tk *inhibitTrack) prune(now time.Time) {
+	for k, e := range tk.data {
+		if !now.Before(e.expire) {
+			delete(tk.data, k)
+		}
+	}
+}
+
+func (tk *inhibitTrack) get(key string) (trackEntry, bool) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	e, ok := tk.data[key]
+	if !ok || !tk.now().Before(e.expire) {
+		return trackEntry{}, false
+	}
+	return *e, true
+}
+
+func (tk *inhibitTrack) remove(key string) bool {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	_, ok := tk.data[key]
+	delete(tk.data, key)
+	return ok
+}
+
+// list 计数大于1 也就是正在抑制告警的key 按照计数倒序
+func (tk *inhibitTrack) list() []InhibitKey {
+	now := tk.now()
+
+	tk.mu.Lock()
+	tk.prune(now)
+	var keys []InhibitKey
+	for k, e := range tk.data {
+		if e.count <= 1 {
+			continue
+		}
+		keys = append(keys, InhibitKey{Key: k, Rule: e.rule, Count: e.count, TTL: e.expire.Sub(now)})
+	}
+	tk.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count == keys[j].Count {
+			return keys[i].Key < keys[j].Key
+		}
+		return keys[i].Count > keys[j].Count
+	})
+	return keys
+}
+
+// Inhibited 当前正在抑制告警的key
+func (a *Audit) Inhibited() []InhibitKey {
+	return a.track.list()
+}
+
+// Release 清除限速key 下一条告警会正常发出
+// bucket 不支持删除时只清除内存中的记录 返回错误 bucket 中的计数等到ttl过期 告警仍然被抑制
+func (a *Audit) Release(key string) error {
+	cfg := a.config()
+	a.track.remove(key)
+	a.mem.Delete(key)
+
+	if cfg.backend == BackendMemory || len(cfg.bkt) == 0 {
+		return nil
+	}
+
+	db, ok := a.environ().Bucket(cfg.bkt...).(bucketDeleter)
+	if !ok {
+		return fmt.Errorf("bucket %v does not support delete , %s released in memory only", cfg.bkt, key)
+	}
+	return db.Delete(key)
+}
+
+// Explain 事件会命中的限速规则和key 不会累加计数
+func (a *Audit) Explain(ev *Event) []InhibitHit {
+	cfg := a.config()
+	hits := make([]InhibitHit, 0, len(cfg.rate))
+	if a.never(ev, cfg) {
+		return hits
+	}
+
+	//其他进程累加的计数只在 bucket 中
+	counter, _ := a.bucket(cfg).(bucketCounter)
+
+	for _, r := range cfg.rate {
+		if !r.scope(ev) {
+			continue
+		}
+
+		key := r.Key(ev)
+		hit := InhibitHit{Rule: r.tag, Key: key, TTL: time.Duration(r.ttl) * time.Second}
+		if e, ok := a.track.get(key); ok {
+			hit.Count = e.count
+			hit.TTL = e.expire.Sub(a.track.now())
+		}
+		if counter != nil {
+			if n := counter.Count(key); n > hit.Count {
+				hit.Count = n
+			}
+		}
+		//和 inhibit 一样 计数是之前的次数 escalate 放行的这一条不算抑制
+		if ev.alert && hit.Count >= 1 {
+			hit.Escalate = r.escalates(hit.Count)
+			hit.Inhibit = !hit.Escalate
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
@@ -4,41 +4,380 @@ import (
 	"github.com/vela-security/vela-public/auxlib"
 	"github.com/vela-security/vela-public/lua"
 	"github.com/vela-security/vela-public/pipe"
+	"strings"
+	"time"
 )
 
 func (a *Audit) toL(L *lua.LState) int {
-	a.cfg.sdk = auxlib.CheckWriter(L.CheckProcData(1), L)
+	w := auxlib.CheckWriter(L.CheckProcData(1), L)
+	a.update(func(cfg *config) { cfg.sdk = w })
 	return 0
 }
 
 func (a *Audit) pipeL(L *lua.LState) int {
-	a.cfg.pipe.CheckMany(L, pipe.Seek(0))
+	px := pipe.New()
+	px.CheckMany(L, pipe.Seek(0))
+	a.update(func(cfg *config) { cfg.pipe = append(cfg.pipe, px) })
 	return 0
 }
 
+/*
+	adt.pass("typeof = login && level <= 次要")
+	adt.pass("error.cause" , "connection refused")
+*/
+
 func (a *Audit) passL(L *lua.LState) int {
-	key := L.CheckString(1)
-	filter := L.CheckString(2)
-	a.cfg.pass = append(a.cfg.pass, newFilter(key, filter))
+	var m match
+	if L.GetTop() == 1 {
+		m = checkCondition(L, L.CheckString(1))
+	} else {
+		m = newFilter(L.CheckString(1), L.CheckString(2))
+	}
+
+	a.update(func(cfg *config) { cfg.pass = append(cfg.pass, m) })
 	return 0
 }
 
+/*
+	adt.inhibit("$id_$typeof" , 300)
+	adt.inhibit("$id_$typeof" , 300 , "level <= 次要 && typeof = login")
+	adt.inhibit{tag = "$id_$typeof" , ttl = 300 , when = "from = sshd" , escalate = 100}
+*/
+
 func (a *Audit) inhibitL(L *lua.LState) int {
-	tag := L.CheckString(1)
-	ttl := L.CheckInt(2)
-	a.cfg.rate = append(a.cfg.rate, newInhibitMatch(tag, ttl))
+	var r *inhibitRule
+
+	if tab, ok := L.Get(1).(*lua.LTable); ok {
+		r = newInhibitRule(tab.RawGetString("tag").String(), lua.IsInt(tab.RawGetString("ttl")))
+		if when := tab.RawGetString("when"); when.Type() == lua.LTString {
+			r.when = checkCondition(L, when.String())
+		}
+		r.escalate = lua.IsInt(tab.RawGetString("escalate"))
+	} else {
+		r = newInhibitRule(L.CheckString(1), L.CheckInt(2))
+		if L.GetTop() >= 3 {
+			r.when = checkCondition(L, L.CheckString(3))
+		}
+	}
+
+	if r.tag == "" || r.ttl <= 0 {
+		L.RaiseError("invalid inhibit tag:%s ttl:%d", r.tag, r.ttl)
+		return 0
+	}
+
+	a.update(func(cfg *config) { cfg.rate = append(cfg.rate, r) })
 	return 0
 }
 
+/*
+	adt.rollup{key = "$typeof_$remote_addr" , window = 10 , when = "typeof = portscan" , sample = {"remote_port"} , max = 10}
+*/
+
+func (a *Audit) rollupL(L *lua.LState) int {
+	tab := L.CheckTable(1)
+	r := newRollupRule(tab.RawGetString("key").String(), lua.IsInt(tab.RawGetString("window")))
+
+	if when := tab.RawGetString("when"); when.Type() == lua.LTString {
+		r.when = checkCondition(L, when.String())
+	}
+
+	if sample, ok := tab.RawGetString("sample").(*lua.LTable); ok {
+		sample.Range(func(_ string, v lua.LValue) {
+			r.sample = append(r.sample, v.String())
+		})
+	}
+
+	if max := lua.IsInt(tab.RawGetString("max")); max > 0 {
+		r.max = max
+	}
+
+	if r.tag == "" || r.window <= 0 {
+		L.RaiseError("invalid rollup key:%s window:%v", r.tag, r.window)
+		return 0
+	}
+
+	a.update(func(cfg *config) { cfg.rollup = append(cfg.rollup, r) })
+	return 0
+}
+
+/*
+	adt.sample{rate = 0.1 , key = "$user_$inet" , when = "typeof = logger && level = 普通"}
+*/
+
+func (a *Audit) sampleL(L *lua.LState) int {
+	tab := L.CheckTable(1)
+	rate, _ := tab.RawGetString("rate").AssertFloat64()
+	if rate <= 0 || rate > 1 {
+		L.RaiseError("invalid sample rate %v , must be (0 , 1]", rate)
+		return 0
+	}
+
+	var tag string
+	if key := tab.RawGetString("key"); key.Type() == lua.LTString {
+		tag = key.String()
+	}
+
+	r := newSampleRule(rate, tag)
+	if when := tab.RawGetString("when"); when.Type() == lua.LTString {
+		r.when = checkCondition(L, when.String())
+	}
+
+	a.update(func(cfg *config) { cfg.sample = append(cfg.sample, r) })
+	return 0
+}
+
+/*
+	adt.otlp{url = "http://127.0.0.1:4318/v1/logs" , batch = 512 , interval = 5 , timeout = 5 , headers = {}}
+*/
+
+func (a *Audit) otlpL(L *lua.LState) int {
+	tab := L.CheckTable(1)
+	cfg := OTLPConfig{
+		URL:      tab.RawGetString("url").String(),
+		Batch:    lua.IsInt(tab.RawGetString("batch")),
+		Interval: time.Duration(lua.IsInt(tab.RawGetString("interval"))) * time.Second,
+		Timeout:  time.Duration(lua.IsInt(tab.RawGetString("timeout"))) * time.Second,
+		Lang:     tabString(tab, "lang"),
+		Errorf:   a.environ().Errorf,
+	}
+
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		L.RaiseError("invalid otlp url %s", cfg.URL)
+		return 0
+	}
+
+	if cfg.Lang != "" && !checkLang(cfg.Lang) {
+		L.RaiseError("invalid otlp lang %s , must be zh or en", cfg.Lang)
+		return 0
+	}
+
+	if headers, ok := tab.RawGetString("headers").(*lua.LTable); ok {
+		cfg.Headers = make(map[string]string)
+		headers.Range(func(k string, v lua.LValue) {
+			cfg.Headers[k] = v.String()
+		})
+	}
+
+	a.addOTLP(NewOTLPSink(cfg))
+	return 0
+}
+
+func (a *Audit) neverInhibitL(L *lua.LState) int {
+	n := L.GetTop()
+	levels := make([]Severity, 0, n)
+	for i := 1; i <= n; i++ {
+		levels = append(levels, checkSeverity(L, L.Get(i).String()))
+	}
+
+	a.update(func(cfg *config) { cfg.never = append(cfg.never, levels...) })
+	return 0
+}
+
+func (a *Audit) inhibitStatsL(L *lua.LState) int {
+	st := a.InhibitStats()
+	tab := L.NewTable()
+	tab.RawSetString("keys", lua.LInt(st.Keys))
+	tab.RawSetString("max_keys", lua.LInt(st.MaxKeys))
+	tab.RawSetString("expired", lua.LNumber(st.Expired))
+	tab.RawSetString("evicted", lua.LNumber(st.Evicted))
+	tab.RawSetString("fallback", lua.LNumber(st.Fallback))
+	L.Push(tab)
+	return 1
+}
+
+func seriesL(L *lua.LState, s Series) *lua.LTable {
+	tab := L.NewTable()
+	tab.RawSetString("put", lua.LNumber(s.Put))
+	tab.RawSetString("dropped", lua.LNumber(s.Dropped))
+	tab.RawSetString("bypass", lua.LNumber(s.Bypass))
+	tab.RawSetString("sampled", lua.LNumber(s.Sampled))
+	tab.RawSetString("rolled", lua.LNumber(s.Rolled))
+	tab.RawSetString("inhibited", lua.LNumber(s.Inhibited))
+	tab.RawSetString("uploaded", lua.LNumber(s.Uploaded))
+	tab.RawSetString("failed", lua.LNumber(s.Failed))
+
+	latency := L.NewTable()
+	latency.RawSetString("count", lua.LNumber(s.Latency.Count))
+	latency.RawSetString("sum", lua.LNumber(s.Latency.Sum))
+	tab.RawSetString("latency", latency)
+	return tab
+}
+
+func groupL(L *lua.LState, m map[string]Series) *lua.LTable {
+	tab := L.NewTable()
+	for k, s := range m {
+		tab.RawSetString(k, seriesL(L, s))
+	}
+	return tab
+}
+
+/*
+	local st = adt.stats()
+	print(st.put , st.uploaded , st.typeof.login.inhibited , st.latency.sum)
+*/
+
+func (a *Audit) statsL(L *lua.LState) int {
+	st := a.Stats()
+	tab := seriesL(L, st.Series)
+	tab.RawSetString("typeof", groupL(L, st.Typeof))
+	tab.RawSetString("level", groupL(L, st.Level))
+	tab.RawSetString("from", groupL(L, st.From))
+	tab.RawSetString("spool_dropped", lua.LNumber(st.SpoolDropped))
+	L.Push(tab)
+	return 1
+}
+
+func (a *Audit) inhibitedL(L *lua.LState) int {
+	keys := a.Inhibited()
+	tab := L.CreateTable(len(keys), 0)
+	for _, k := range keys {
+		item := L.NewTable()
+		item.RawSetString("key", lua.S2L(k.Key))
+		item.RawSetString("rule", lua.S2L(k.Rule))
+		item.RawSetString("count", lua.LInt(k.Count))
+		item.RawSetString("ttl", lua.LInt(int(k.TTL.Seconds())))
+		tab.Append(item)
+	}
+	L.Push(tab)
+	return 1
+}
+
+func (a *Audit) releaseL(L *lua.LState) int {
+	key := L.CheckString(1)
+	if err := a.Release(key); err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.S2L(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LTrue)
+	return 1
+}
+
+func (a *Audit) explainL(L *lua.LState) int {
+	ev := CheckEvent(L, 1)
+	if ev == nil {
+		return 0
+	}
+
+	hits := a.Explain(ev)
+	tab := L.CreateTable(len(hits), 0)
+	for _, h := range hits {
+		item := L.NewTable()
+		item.RawSetString("rule", lua.S2L(h.Rule))
+		item.RawSetString("key", lua.S2L(h.Key))
+		item.RawSetString("count", lua.LInt(h.Count))
+		item.RawSetString("ttl", lua.LInt(int(h.TTL.Seconds())))
+		item.RawSetString("inhibit", lua.LBool(h.Inhibit))
+		item.RawSetString("escalate", lua.LBool(h.Escalate))
+		tab.Append(item)
+	}
+	L.Push(tab)
+	return 1
+}
+
+func tabString(tab *lua.LTable, key string) string {
+	if lv := tab.RawGetString(key); lv.Type() == lua.LTString {
+		return lv.String()
+	}
+	return ""
+}
+
+/*
+	local evs = adt.query{typeof = "login" , since = "1h" , user = "root" , limit = 100}
+	local evs = adt.query{text = "登录失败 \"invalid user\" adm*" , since = "1d"}
+*/
+
+func (a *Audit) queryL(L *lua.LState) int {
+	return a.doQuery(L, L.CheckTable(1), "")
+}
+
+/*
+	local evs = adt.search("登录失败 root*" , {typeof = "login" , since = "1h"})
+*/
+
+func (a *Audit) searchL(L *lua.LState) int {
+	text := L.CheckString(1)
+	tab, ok := L.Get(2).(*lua.LTable)
+	if !ok {
+		tab = L.NewTable()
+	}
+	return a.doQuery(L, tab, text)
+}
+
+func (a *Audit) doQuery(L *lua.LState, tab *lua.LTable, text string) int {
+	now := a.environ().Now()
+
+	var q Query
+	var err error
+	if q.Since, err = parseSince(tabString(tab, "since"), now); err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
+
+	if q.Until, err = parseSince(tabString(tab, "until"), now); err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
+
+	q.Typeof = tabString(tab, "typeof")
+	q.User = tabString(tab, "user")
+	q.RemoteAddr = tabString(tab, "remote_addr")
+	q.From = tabString(tab, "from")
+	q.Text = tabString(tab, "text")
+	if text != "" {
+		q.Text = text
+	}
+	q.Limit = lua.IsInt(tab.RawGetString("limit"))
+	if lv := tab.RawGetString("level"); lv.Type() == lua.LTString {
+		q.Level = checkSeverity(L, lv.String()).String()
+	}
+
+	evs, err := a.Query(q)
+	ret := L.CreateTable(len(evs), 0)
+	for _, ev := range evs {
+		ret.Append(ev)
+	}
+
+	L.Push(ret)
+	if err != nil {
+		L.Push(lua.S2L(err.Error()))
+		return 2
+	}
+	return 1
+}
+
+/*
+	local body = adt.attachment(ev.msg_ref)
+	local body = adt.attachment(ev)
+*/
+
+func (a *Audit) attachmentL(L *lua.LState) int {
+	ref := L.Get(1).String()
+	if ev, ok := L.Get(1).(*Event); ok {
+		ref = ev.ref
+	}
+
+	data, err := a.Attachment(ref)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.S2L(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.B2L(data))
+	return 1
+}
+
 func (a *Audit) initL(L *lua.LState) int {
 	adt := CheckAdt()
 	cfg := newConfig(L)
 	proc := L.NewProc(a.Name(), typeof)
 	if proc.IsNil() {
-		adt.cfg = cfg
+		adt.reload(cfg)
 		proc.Set(adt)
 	} else {
-		adt.cfg = cfg
+		adt.reload(cfg)
 	}
 
 	L.Push(proc)
@@ -72,6 +411,45 @@ func (a *Audit) Index(L *lua.LState, key string) lua.LValue {
 	case "inhibit":
 		return lua.NewFunction(a.inhibitL)
 
+	case "sample":
+		return lua.NewFunction(a.sampleL)
+
+	case "rollup":
+		return lua.NewFunction(a.rollupL)
+
+	case "never_inhibit":
+		return lua.NewFunction(a.neverInhibitL)
+
+	case "inhibit_stats":
+		return lua.NewFunction(a.inhibitStatsL)
+
+	case "inhibited":
+		return lua.NewFunction(a.inhibitedL)
+
+	case "otlp":
+		return lua.NewFunction(a.otlpL)
+
+	case "query":
+		return lua.NewFunction(a.queryL)
+
+	case "search":
+		return lua.NewFunction(a.searchL)
+
+	case "subscribe":
+		return lua.NewFunction(a.subscribeL)
+
+	case "attachment":
+		return lua.NewFunction(a.attachmentL)
+
+	case "stats":
+		return lua.NewFunction(a.statsL)
+
+	case "release":
+		return lua.NewFunction(a.releaseL)
+
+	case "explain":
+		return lua.NewFunction(a.explainL)
+
 	case "start":
 		return lua.NewFunction(func(co *lua.LState) int {
 			xEnv.Start(L, a).From(co.CodeVM()).Do()
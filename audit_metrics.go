@@ -0,0 +1,191 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var stageName = [mMetrics]string{"put", "dropped", "bypass", "sampled", "rolled", "inhibited", "uploaded", "failed"}
+
+func (c Counter) stages() [mMetrics]uint64 {
+	return [mMetrics]uint64{c.Put, c.Dropped, c.Bypass, c.Sampled, c.Rolled, c.Inhibited, c.Uploaded, c.Failed}
+}
+
+var labelEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLabel(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscape.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (mw *metricWriter) family(name, typ, help string) {
+	fmt.Fprintf(mw.w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+func (mw *metricWriter) sample(name, labels string, v string) {
+	mw.w.WriteString(name)
+	mw.w.WriteString(labels)
+	mw.w.WriteByte(' ')
+	mw.w.WriteString(v)
+	mw.w.WriteByte('\n')
+}
+
+func (mw *metricWriter) group(name, dim string, m map[string]Series) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m[k].stages()
+		for i := 0; i < mMetrics; i++ {
+			mw.sample(name, metricLabel(dim, k, "stage", stageName[i]), strconv.FormatUint(v[i], 10))
+		}
+	}
+}
+
+// WriteMetrics 按照 OpenMetrics 文本格式输出审计计数
+func (a *Audit) WriteMetrics(w io.Writer) error {
+	st := a.Stats()
+	mw := &metricWriter{w: bufio.NewWriter(w)}
+
+	mw.family("vela_audit_events", "counter", "audit events by pipeline stage")
+	total := st.stages()
+	for i := 0; i < mMetrics; i++ {
+		mw.sample("vela_audit_events_total", metricLabel("stage", stageName[i]), strconv.FormatUint(total[i], 10))
+	}
+
+	mw.family("vela_audit_typeof_events", "counter", "audit events by typeof and stage")
+	mw.group("vela_audit_typeof_events_total", "typeof", st.Typeof)
+
+	mw.family("vela_audit_level_events", "counter", "audit events by level and stage")
+	mw.group("vela_audit_level_events_total", "level", st.Level)
+
+	mw.family("vela_audit_dropped", "counter", "events dropped after audit closed")
+	mw.sample("vela_audit_dropped_total", "", strconv.FormatUint(st.Dropped, 10))
+
+	mw.family("vela_audit_inhibited", "counter", "alerts suppressed by inhibit rules")
+	mw.sample("vela_audit_inhibited_total", "", strconv.FormatUint(st.Inhibited, 10))
+
+	mw.family("vela_audit_tnl_send_errors", "counter", "tunnel send failures")
+	mw.sample("vela_audit_tnl_send_errors_total", "", strconv.FormatUint(st.Failed, 10))
+
+	mw.family("vela_audit_file_bytes_written", "counter", "bytes written to the audit log file")
+	mw.sample("vela_audit_file_bytes_written_total", "", strconv.FormatUint(atomic.LoadUint64(&a.written), 10))
+
+	mw.family("vela_audit_queue_depth", "gauge", "events waiting in audit queues")
+	for _, q := range a.queues() {
+		mw.sample("vela_audit_queue_depth", metricLabel("queue", q.name), strconv.Itoa(q.depth))
+	}
+
+	mw.family("vela_audit_spool_bytes", "gauge", "bytes waiting in the upload spool")
+	mw.sample("vela_audit_spool_bytes", "", strconv.FormatInt(a.dlv.size(), 10))
+
+	mw.family("vela_audit_spool_dropped", "counter", "failed uploads dropped without spooling")
+	mw.sample("vela_audit_spool_dropped_total", "", strconv.FormatUint(st.SpoolDropped, 10))
+
+	mem := a.InhibitStats()
+	mw.family("vela_audit_inhibit_keys", "gauge", "keys in the memory inhibit store")
+	mw.sample("vela_audit_inhibit_keys", "", strconv.Itoa(mem.Keys))
+
+	mw.family("vela_audit_handle_seconds", "histogram", "audit handle latency")
+	var cum uint64
+	for i, b := range st.Latency.Bounds {
+		cum += st.Latency.Counts[i]
+		mw.sample("vela_audit_handle_seconds_bucket", metricLabel("le", fmtFloat(b)), strconv.FormatUint(cum, 10))
+	}
+	mw.sample("vela_audit_handle_seconds_bucket", metricLabel("le", "+Inf"), strconv.FormatUint(st.Latency.Count, 10))
+	mw.sample("vela_audit_handle_seconds_count", "", strconv.FormatUint(st.Latency.Count, 10))
+	mw.sample("vela_audit_handle_seconds_sum", "", fmtFloat(st.Latency.Sum))
+
+	mw.w.WriteString("# EOF\n")
+	return mw.w.Flush()
+}
+
+type queueDepth struct {
+	name  string
+	depth int
+}
+
+func (a *Audit) queues() []queueDepth {
+	return []queueDepth{{name: "rollup", depth: a.roll.size()}}
+}
+
+// MetricsHandler 可以挂载到已有的 http 服务上
+func (a *Audit) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", openMetricsType)
+		if err := a.WriteMetrics(w); err != nil {
+			a.E(err)
+		}
+	})
+}
+
+// serveMetrics 按照配置启动或者关闭本地 metrics 监听 地址没有变化时不处理
+func (a *Audit) serveMetrics(addr string) {
+	a.msrvMu.Lock()
+	defer a.msrvMu.Unlock()
+
+	if a.msrv != nil && a.msrv.Addr == addr {
+		return
+	}
+
+	if a.msrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		a.msrv.Shutdown(ctx)
+		cancel()
+		a.msrv = nil
+	}
+
+	if addr == "" {
+		return
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		a.environ().Errorf("%s metrics listen %s fail %v", a.Name(), addr, err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.MetricsHandler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	a.msrv = srv
+
+	go func() {
+		if e := srv.Serve(ln); e != nil && e != http.ErrServerClosed {
+			a.environ().Errorf("%s metrics serve fail %v", a.Name(), e)
+		}
+	}()
+}
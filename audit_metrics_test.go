@@ -0,0 +1,99 @@
+package audit_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	if err := adt.SetInhibit("$typeof", 60, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	adt.NewEvent("login").Put()
+	adt.NewEvent("login").SetSeverity(audit.SeverityHigh).Put()
+	adt.NewEvent("portscan").Alert().Put()
+	adt.NewEvent("portscan").Alert().Put()
+	adt.NewEvent(`a"b`).Put()
+
+	srv := httptest.NewServer(adt.MetricsHandler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("expect openmetrics content type , got %s", ct)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(raw)
+
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatalf("expect # EOF at end , got %q", body)
+	}
+
+	lines := strings.Split(body, "\n")
+	have := make(map[string]string, len(lines))
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		have[line[:i]] = line[i+1:]
+	}
+
+	cases := []struct {
+		sample string
+		want   string
+	}{
+		{`vela_audit_events_total{stage="put"}`, "5"},
+		{`vela_audit_events_total{stage="inhibited"}`, "1"},
+		{`vela_audit_typeof_events_total{typeof="login",stage="put"}`, "2"},
+		{`vela_audit_typeof_events_total{typeof="portscan",stage="inhibited"}`, "1"},
+		{`vela_audit_typeof_events_total{typeof="a\"b",stage="put"}`, "1"},
+		{`vela_audit_level_events_total{level="重要",stage="put"}`, "1"},
+		{`vela_audit_dropped_total`, "0"},
+		{`vela_audit_inhibited_total`, "1"},
+		{`vela_audit_spool_dropped_total`, "0"},
+		{`vela_audit_queue_depth{queue="rollup"}`, "0"},
+		{`vela_audit_handle_seconds_bucket{le="+Inf"}`, "5"},
+		{`vela_audit_handle_seconds_count`, "5"},
+	}
+
+	for _, c := range cases {
+		if got, ok := have[c.sample]; !ok || got != c.want {
+			t.Fatalf("expect %s %s , got %q %v", c.sample, c.want, got, ok)
+		}
+	}
+
+	// 每个样本之前都要有对应的 TYPE 声明
+	typed := make(map[string]bool)
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := line[:strings.IndexAny(line, "{ ")]
+		family := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name,
+			"_total"), "_bucket"), "_count"), "_sum")
+		if !typed[family] {
+			t.Fatalf("sample %s without # TYPE %s", name, family)
+		}
+	}
+}
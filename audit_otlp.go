@@ -0,0 +1,398 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pb 最小的 protobuf 编码 只覆盖 OTLP logs 用到的类型
+type pb struct {
+	buf []byte
+}
+
+func (p *pb) tag(field int, wire int) {
+	p.varint(uint64(field<<3 | wire))
+}
+
+func (p *pb) varint(v uint64) {
+	p.buf = binary.AppendUvarint(p.buf, v)
+}
+
+func (p *pb) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, 0)
+	p.varint(v)
+}
+
+func (p *pb) fixed64(field int, v uint64) {
+	p.tag(field, 1)
+	p.buf = binary.LittleEndian.AppendUint64(p.buf, v)
+}
+
+func (p *pb) bytes(field int, v []byte) {
+	p.tag(field, 2)
+	p.varint(uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+func (p *pb) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, 2)
+	p.varint(uint64(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+// message 嵌套消息 先编码到临时缓冲再写入长度
+func (p *pb) message(field int, fn func(*pb)) {
+	var sub pb
+	fn(&sub)
+	p.bytes(field, sub.buf)
+}
+
+// AnyValue string_value=1 bool_value=2 int_value=3 double_value=4
+func (p *pb) kv(field int, key string, val interface{}) {
+	p.message(field, func(m *pb) {
+		m.string(1, key)
+		m.message(2, func(v *pb) {
+			switch n := val.(type) {
+			case string:
+				v.tag(1, 2)
+				v.varint(uint64(len(n)))
+				v.buf = append(v.buf, n...)
+			case bool:
+				v.tag(2, 0)
+				if n {
+					v.varint(1)
+				} else {
+					v.varint(0)
+				}
+			case int:
+				v.tag(3, 0)
+				v.varint(uint64(int64(n)))
+			case float64:
+				v.fixed64(4, math.Float64bits(n))
+			default:
+				s := fmt.Sprint(n)
+				v.tag(1, 2)
+				v.varint(uint64(len(s)))
+				v.buf = append(v.buf, s...)
+			}
+		})
+	})
+}
+
+// otlpSeverity 严重 使用 ERROR2 和 重要 区分
+func otlpSeverity(s Severity) (uint64, string) {
+	switch s {
+	case SeverityCritical:
+		return 21, "FATAL"
+	case SeveritySerious:
+		return 18, "ERROR2"
+	case SeverityHigh:
+		return 17, "ERROR"
+	case SeverityLow:
+		return 13, "WARN"
+	default:
+		return 9, "INFO"
+	}
+}
+
+// otlpRecord 编码 LogRecord msg 作为body 其他字段作为属性
+func otlpRecord(ev *Event, lang string, observed time.Time) []byte {
+	var p pb
+	severity, text := otlpSeverity(ev.level)
+
+	p.fixed64(1, uint64(ev.time.UnixNano()))
+	p.uint(2, severity)
+	p.string(3, text)
+	p.message(5, func(v *pb) { v.string(1, ev.msg) })
+
+	p.kv(6, "event.id", ev.uid)
+	p.kv(6, "vela.typeof", ev.typeof)
+	p.kv(6, "vela.subject", ev.subject)
+	p.kv(6, "vela.from", ev.from)
+	p.kv(6, "vela.level", ev.level.Label(lang))
+	p.kv(6, "vela.severity", int(ev.level))
+	p.kv(6, "vela.alert", ev.alert)
+	if ev.trace != "" {
+		p.kv(6, "vela.trace_id", ev.trace)
+	}
+	if ev.parent != "" {
+		p.kv(6, "vela.parent_id", ev.parent)
+	}
+	if ev.user != "" {
+		p.kv(6, "user.name", ev.user)
+	}
+	if ev.auth != "" {
+		p.kv(6, "vela.auth", ev.auth)
+	}
+	if ev.rAddr != "" {
+		p.kv(6, "client.address", ev.rAddr)
+		p.kv(6, "client.port", ev.rPort)
+		p.kv(6, "vela.region", ev.region)
+	}
+	if ev.ref != "" {
+		p.kv(6, "vela.msg_ref", ev.ref)
+		p.kv(6, "vela.msg_size", ev.size)
+	}
+	if ev.err != nil {
+		p.kv(6, "exception.message", ev.err.Error())
+		p.kv(6, "exception.type", errorType(ev.err))
+		if ev.stack != "" {
+			p.kv(6, "exception.stacktrace", ev.stack)
+		}
+	}
+	if ev.roll != nil {
+		p.kv(6, "vela.count", ev.roll.count)
+	}
+	if ev.rate > 0 && ev.rate < 1 {
+		p.kv(6, "vela.sample_rate", ev.rate)
+	}
+	for _, a := range ev.attrs {
+		p.kv(6, "vela.attr."+a.key, a.val)
+	}
+
+	p.fixed64(11, uint64(observed.UnixNano()))
+	return p.buf
+}
+
+type otlpResource struct {
+	id   string
+	inet string
+}
+
+// OTLPConfig OTLP/HTTP protobuf 导出配置
+type OTLPConfig struct {
+	URL      string
+	Headers  map[string]string
+	Batch    int
+	Interval time.Duration
+	Timeout  time.Duration
+	Lang     string // vela.level 的语言 默认中文
+	Errorf   func(format string, v ...interface{})
+}
+
+// OTLPSink 把事件转换为 OTLP LogRecord 批量发送到 collector
+type OTLPSink struct {
+	cfg    OTLPConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	pending map[otlpResource][][]byte
+	size    int
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func NewOTLPSink(cfg OTLPConfig) *OTLPSink {
+	if cfg.Batch <= 0 {
+		cfg.Batch = 512
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	if cfg.Errorf == nil {
+		cfg.Errorf = defaultEnv.Errorf
+	}
+
+	if !checkLang(cfg.Lang) {
+		cfg.Lang = LangZH
+	}
+
+	s := &OTLPSink{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		pending: make(map[otlpResource][][]byte),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go s.loop()
+	return s
+}
+
+func (s *OTLPSink) Write(ev *Event) error {
+	rec := otlpRecord(ev, s.cfg.Lang, time.Now())
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return fmt.Errorf("otlp sink closed")
+	}
+
+	res := otlpResource{id: ev.id, inet: ev.inet}
+	s.pending[res] = append(s.pending[res], rec)
+	s.size++
+	full := s.size >= s.cfg.Batch
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *OTLPSink) loop() {
+	defer close(s.done)
+
+	tk := time.NewTicker(s.cfg.Interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.flush()
+			return
+		case <-tk.C:
+			s.flush()
+		case <-s.kick:
+			s.flush()
+		}
+	}
+}
+
+func (s *OTLPSink) take() map[otlpResource][][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size == 0 {
+		return nil
+	}
+
+	batch := s.pending
+	s.pending = make(map[otlpResource][][]byte)
+	s.size = 0
+	return batch
+}
+
+// otlpBacklog 发送失败后最多保留的批次数 超过时丢弃失败的批次
+const otlpBacklog = 8
+
+func (s *OTLPSink) flush() {
+	batch := s.take()
+	if batch == nil {
+		return
+	}
+
+	if err := s.post(encodeOTLP(batch)); err != nil {
+		s.cfg.Errorf("otlp export %s fail %v", s.cfg.URL, err)
+		s.requeue(batch)
+	}
+}
+
+// requeue 失败的批次放回队列头部 下一次发送时重试 关闭后不再保留
+func (s *OTLPSink) requeue(batch map[otlpResource][][]byte) {
+	n := 0
+	for _, records := range batch {
+		n += len(records)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.size+n > s.cfg.Batch*otlpBacklog {
+		s.cfg.Errorf("otlp export %s drop %d records", s.cfg.URL, n)
+		return
+	}
+
+	for res, records := range batch {
+		s.pending[res] = append(records, s.pending[res]...)
+	}
+	s.size += n
+}
+
+// encodeOTLP ExportLogsServiceRequest
+func encodeOTLP(batch map[otlpResource][][]byte) []byte {
+	var p pb
+	for res, records := range batch {
+		p.message(1, func(rl *pb) {
+			rl.message(1, func(r *pb) {
+				r.kv(1, "service.name", "vela")
+				r.kv(1, "host.id", res.id)
+				r.kv(1, "host.ip", res.inet)
+			})
+			rl.message(2, func(sl *pb) {
+				sl.message(1, func(scope *pb) {
+					scope.string(1, "vela-audit")
+				})
+				for _, rec := range records {
+					sl.bytes(2, rec)
+				}
+			})
+		})
+	}
+	return p.buf
+}
+
+func (s *OTLPSink) post(body []byte) error {
+	r, err := http.NewRequest(http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range s.cfg.Headers {
+		r.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector response %s", resp.Status)
+	}
+	return nil
+}
+
+// Close 发送剩余的事件
+func (s *OTLPSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+// addOTLP 脚本重新执行时 替换相同地址的导出 不重复注册
+func (a *Audit) addOTLP(s *OTLPSink) {
+	old := a.hook.replace(s, func(item Sink) bool {
+		o, ok := item.(*OTLPSink)
+		return ok && o.cfg.URL == s.cfg.URL
+	})
+
+	for _, o := range old {
+		a.E(o.Close())
+	}
+}
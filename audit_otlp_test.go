@@ -0,0 +1,155 @@
+package audit_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+	"github.com/vela-security/vela-audit/audittest"
+)
+
+// waitFor 等待后台发送完成 超时失败
+func waitFor(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type errLog struct {
+	mu   sync.Mutex
+	text []string
+}
+
+func (e *errLog) Errorf(format string, v ...interface{}) {
+	e.mu.Lock()
+	e.text = append(e.text, fmt.Sprintf(format, v...))
+	e.mu.Unlock()
+}
+
+func (e *errLog) has(sub string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.text {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOTLPExport(t *testing.T) {
+	c := audittest.NewCollector()
+	defer c.Close()
+
+	adt, _, _ := newAudit(t)
+	sink := audit.NewOTLPSink(audit.OTLPConfig{URL: c.Endpoint(), Batch: 2, Interval: time.Hour, Lang: audit.LangEN})
+	adt.AddSink(sink)
+
+	adt.NewEvent("login").User("root").Msg("bad password").Attr("port", 22).SetSeverity(audit.SeveritySerious).Put()
+	adt.NewEvent("login").User("admin").Msg("ok").Put()
+	waitFor(t, "first batch", func() bool { return c.Posts() == 1 })
+
+	adt.NewEvent("logout").Msg("bye").Put()
+	if err := adt.RemoveSink(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.Posts(); n != 2 {
+		t.Fatalf("expect 2 batches , got %d", n)
+	}
+
+	records := c.Records()
+	if len(records) != 3 {
+		t.Fatalf("expect 3 records , got %d", len(records))
+	}
+
+	r := records[0]
+	if r.Severity != 18 || r.SeverityText != "ERROR2" {
+		t.Fatalf("expect severity 18 ERROR2 , got %d %s", r.Severity, r.SeverityText)
+	}
+	if r.Body != "bad password" {
+		t.Fatalf("expect body bad password , got %q", r.Body)
+	}
+
+	attrs := map[string]string{
+		"vela.typeof":    "login",
+		"vela.level":     "serious",
+		"vela.severity":  "4",
+		"user.name":      "root",
+		"vela.attr.port": "22",
+	}
+	for k, v := range attrs {
+		if r.Attrs[k] != v {
+			t.Fatalf("expect attr %s=%s , got %q", k, v, r.Attrs[k])
+		}
+	}
+
+	res := map[string]string{
+		"service.name": "vela",
+		"host.id":      audittest.ID,
+		"host.ip":      audittest.Inet,
+	}
+	for k, v := range res {
+		if r.Resource[k] != v {
+			t.Fatalf("expect resource %s=%s , got %q", k, v, r.Resource[k])
+		}
+	}
+
+	if records[1].Severity != 9 || records[2].Body != "bye" {
+		t.Fatalf("unexpect records %+v", records[1:])
+	}
+}
+
+func TestOTLPRetryAfterFail(t *testing.T) {
+	c := audittest.NewCollector()
+	defer c.Close()
+	c.Status(500)
+
+	log := &errLog{}
+	adt, _, _ := newAudit(t)
+	sink := audit.NewOTLPSink(audit.OTLPConfig{URL: c.Endpoint(), Batch: 2, Interval: 10 * time.Millisecond, Errorf: log.Errorf})
+	adt.AddSink(sink)
+	defer adt.RemoveSink(sink)
+
+	adt.NewEvent("login").Msg("a").Put()
+	adt.NewEvent("login").Msg("b").Put()
+	waitFor(t, "failed export", func() bool { return log.has("500") })
+
+	c.Status(200)
+	waitFor(t, "retry", func() bool { return len(c.Records()) == 2 })
+
+	records := c.Records()
+	if records[0].Body != "a" || records[1].Body != "b" {
+		t.Fatalf("expect a , b in order , got %s , %s", records[0].Body, records[1].Body)
+	}
+}
+
+func TestOTLPDropOnClose(t *testing.T) {
+	c := audittest.NewCollector()
+	defer c.Close()
+	c.Status(500)
+
+	log := &errLog{}
+	adt, _, _ := newAudit(t)
+	sink := audit.NewOTLPSink(audit.OTLPConfig{URL: c.Endpoint(), Batch: 10, Interval: time.Hour, Errorf: log.Errorf})
+	adt.AddSink(sink)
+
+	adt.NewEvent("login").Msg("a").Put()
+	adt.RemoveSink(sink)
+
+	if len(c.Records()) != 0 {
+		t.Fatal("expect no records")
+	}
+	if !log.has("drop 1 records") {
+		t.Fatalf("expect drop log , got %v", log.text)
+	}
+}
@@ -0,0 +1,140 @@
+package audit_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+// TestConcurrentPutReload 使用 go test -race 运行 Put 和配置修改并发执行
+func TestConcurrentPutReload(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	start(t, adt)
+
+	const (
+		writers = 8
+		events  = 200
+		loops   = 50
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < events; i++ {
+				adt.NewEvent(fmt.Sprintf("t%d", i%4)).User(fmt.Sprintf("u%d", w)).Alert().Put()
+			}
+		}(w)
+	}
+
+	formats := []string{audit.FormatVela, audit.FormatECS, audit.FormatOCSF}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < loops; i++ {
+			if err := adt.SetPass(fmt.Sprintf("typeof = t%d", i%4)); err != nil {
+				t.Error(err)
+			}
+			if err := adt.SetInhibit("$typeof_$user", 60, "typeof != t0", 0); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < loops; i++ {
+			adt.ReloadFormat(formats[i%len(formats)])
+			adt.Stats()
+			adt.Inhibited()
+		}
+	}()
+	wg.Wait()
+
+	total := uint64(writers * events)
+	st := adt.Stats()
+	if st.Put != total {
+		t.Fatalf("expect put %d , got %d", total, st.Put)
+	}
+
+	//没有采样和聚合 每条事件要么旁路 要么上传
+	if st.Bypass+st.Uploaded != total || st.Failed != 0 {
+		t.Fatalf("expect bypass + uploaded = %d , got %+v", total, st.Counter)
+	}
+
+	if st.Inhibited > st.Uploaded {
+		t.Fatalf("inhibited %d more than uploaded %d", st.Inhibited, st.Uploaded)
+	}
+
+	var typeof uint64
+	for _, s := range st.Typeof {
+		typeof += s.Put
+	}
+	if typeof != total {
+		t.Fatalf("expect typeof put sum %d , got %d", total, typeof)
+	}
+
+	if got := len(rec.Events()); got != int(total) {
+		t.Fatalf("expect %d recorded event , got %d", total, got)
+	}
+
+	if got := len(env.Tunnel.Sent()); got != int(st.Uploaded) {
+		t.Fatalf("expect %d upload , got %d", st.Uploaded, got)
+	}
+}
+
+// TestPutDuringClose Close 之后的 Put 记为丢弃 不会访问已经关闭的资源
+func TestPutDuringClose(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	if err := adt.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				adt.NewEvent("login").Put()
+			}
+		}()
+	}
+
+	if err := adt.Close(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+
+	st := adt.Stats()
+	if st.Put+st.Dropped != 800 {
+		t.Fatalf("expect put + dropped = 800 , got %+v", st.Counter)
+	}
+}
+
+// 重新加载沿用第一次的虚拟机 关闭审计对象时释放
+func TestReloadReuseCoroutine(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	if err := adt.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	reused, first := adt.ReloadCoroutine()
+	if reused || first() {
+		t.Fatal("expect first coroutine used and open")
+	}
+
+	for i := 0; i < 3; i++ {
+		if reused, cur := adt.ReloadCoroutine(); !reused || cur() {
+			t.Fatal("expect reload reuse the open coroutine")
+		}
+	}
+
+	adt.Close()
+	if !first() {
+		t.Fatal("expect coroutine closed with audit")
+	}
+}
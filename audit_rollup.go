@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rollupMax = 10
+
+// rollupInfo 聚合之后的事件信息
+type rollupInfo struct {
+	count   int
+	first   time.Time
+	last    time.Time
+	samples []rollupSample
+}
+
+type rollupSample struct {
+	field  string
+	values []string
+}
+
+func (ri *rollupInfo) add(field, val string, max int) {
+	for i := range ri.samples {
+		s := &ri.samples[i]
+		if s.field != field {
+			continue
+		}
+
+		if len(s.values) >= max {
+			return
+		}
+
+		for _, v := range s.values {
+			if v == val {
+				return
+			}
+		}
+		s.values = append(s.values, val)
+		return
+	}
+
+	ri.samples = append(ri.samples, rollupSample{field: field, values: []string{val}})
+}
+
+// rollupRule 相同key的事件在window内合并成一条
+type rollupRule struct {
+	tag    string
+	inh    *inhibit
+	window time.Duration
+	when   match
+	sample []string
+	max    int
+}
+
+func newRollupRule(tag string, window int) *rollupRule {
+	inh := newInhibit(tag)
+	inh.compile()
+	return &rollupRule{tag: tag, inh: inh, window: time.Duration(window) * time.Second, max: rollupMax}
+}
+
+func (r *rollupRule) scope(ev *Event) bool {
+	if r.when == nil {
+		return true
+	}
+	return r.when(ev)
+}
+
+// rollupEntry start 是窗口开始时本机的到达时间 不使用事件自带的时间
+// ev 是窗口内第一条被合并的事件 窗口内没有后续事件时为空
+type rollupEntry struct {
+	rule  *rollupRule
+	start time.Time
+	ev    *Event
+	info  *rollupInfo
+}
+
+// done 窗口结束 返回需要输出的聚合事件 没有合并过事件时为空
+func (e *rollupEntry) done() *Event {
+	if e.ev == nil {
+		return nil
+	}
+
+	if e.info.count > 1 {
+		e.ev.roll = e.info
+	}
+	e.ev.rolled = true
+	e.ev.held = true
+	return e.ev
+}
+
+func (e *rollupEntry) expired(now time.Time) bool {
+	return now.Sub(e.start) >= e.rule.window
+}
+
+// rollup 聚合状态 不随配置重新加载清空
+type rollup struct {
+	mu   sync.Mutex
+	data map[string]*rollupEntry
+}
+
+func newRollup() *rollup {
+	return &rollup{data: make(map[string]*rollupEntry)}
+}
+
+// add 返回true 表示事件已经被合并 不需要继续处理
+// 窗口内的第一条事件立即输出 之后的事件合并到窗口结束时输出
+// 窗口已经结束但是还没有被 rollupLoop 取出时 返回旧窗口的聚合事件 当前事件开始新的窗口
+func (ro *rollup) add(rules []*rollupRule, ev *Event, now time.Time) (bool, *Event) {
+	for idx, r := range rules {
+		if !r.scope(ev) {
+			continue
+		}
+
+		key := strconv.Itoa(idx) + ":" + r.inh.Key(ev)
+
+		ro.mu.Lock()
+		e, ok := ro.data[key]
+		if !ok || e.expired(now) {
+			var due *Event
+			if ok {
+				due = e.done()
+			}
+			ro.data[key] = &rollupEntry{rule: r, start: now, info: &rollupInfo{}}
+			ro.mu.Unlock()
+			return false, due
+		}
+
+		if e.ev == nil {
+			e.ev = ev
+			e.info.first = ev.time
+		}
+
+		e.info.count++
+		e.info.last = ev.time
+		for _, field := range r.sample {
+			if v := ev.Field(field); v != "" {
+				e.info.add(field, v, r.max)
+			}
+		}
+
+		if ev.alert {
+			e.ev.alert = true
+		}
+		ro.mu.Unlock()
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// expire 取出窗口已经结束的聚合事件 force 取出全部
+func (ro *rollup) expire(now time.Time, force bool) []*Event {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	var evs []*Event
+	for key, e := range ro.data {
+		if !force && !e.expired(now) {
+			continue
+		}
+
+		delete(ro.data, key)
+		if ev := e.done(); ev != nil {
+			evs = append(evs, ev)
+		}
+	}
+	return evs
+}
+
+func (ro *rollup) size() int {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	return len(ro.data)
+}
+
+// Flush 立即输出所有正在聚合的事件
+func (a *Audit) Flush() {
+	for _, ev := range a.roll.expire(a.environ().Now(), true) {
+		a.handle(ev)
+	}
+}
+
+func (a *Audit) rollupLoop(stop chan struct{}) {
+	tk := time.NewTicker(time.Second)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C:
+			for _, ev := range a.roll.expire(a.environ().Now(), false) {
+				a.handle(ev)
+			}
+		}
+	}
+}
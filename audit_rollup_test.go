@@ -0,0 +1,118 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupWindow(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	if err := adt.SetRollup("$typeof_$remote_addr", 10, "typeof = portscan", "remote_port"); err != nil {
+		t.Fatal(err)
+	}
+
+	for port := 1; port <= 4; port++ {
+		adt.NewEvent("portscan").Remote("10.0.0.1").Port(port).Alert().Put()
+	}
+
+	//窗口内的第一条立即输出
+	rec.ExpectCount(t, "portscan", 1)
+	if n := adt.ExpireRollup(); n != 0 {
+		t.Fatalf("expect no rollup before window end , got %d", n)
+	}
+
+	env.Clock.Advance(11 * time.Second)
+	if n := adt.ExpireRollup(); n != 1 {
+		t.Fatalf("expect 1 rollup event , got %d", n)
+	}
+
+	rec.ExpectCount(t, "portscan", 2)
+	ev := rec.ExpectAlert(t, "portscan")
+	if ev.Field("count") != "3" {
+		t.Fatalf("expect rollup count 3 , got %q", ev.Field("count"))
+	}
+
+	//合并的事件只在合并时统计一次耗时
+	st := adt.Stats()
+	if st.Rolled != 3 || st.Latency.Count != 4 {
+		t.Fatalf("expect 3 rolled 4 observed , got %d %d", st.Rolled, st.Latency.Count)
+	}
+}
+
+// 窗口结束之后 rollupLoop 取出之前到达的事件 不会合并到已经结束的窗口
+func TestRollupLateArrival(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	if err := adt.SetRollup("$typeof", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("file").Msg("old %d", i).Put()
+	}
+
+	env.Clock.Advance(10 * time.Second)
+	adt.NewEvent("file").Msg("new").Put()
+
+	evs := rec.Typeof("file")
+	if len(evs) != 3 {
+		t.Fatalf("expect first , rollup , new window first , got %d", len(evs))
+	}
+	if evs[1].Field("count") != "2" || evs[1].Field("msg") != "old 1" {
+		t.Fatalf("expect old window rollup count 2 , got %s", evs[1].String())
+	}
+	if evs[2].Field("msg") != "new" || evs[2].Field("count") != "1" {
+		t.Fatalf("expect new event starts a new window , got %s", evs[2].String())
+	}
+
+	//新窗口没有合并过事件 没有需要输出的
+	if n := adt.ExpireRollup(); n != 0 {
+		t.Fatalf("expect old window already flushed , got %d", n)
+	}
+}
+
+// 窗口按照到达时间计算 自带旧时间的事件不会被立即输出
+func TestRollupArrivalTime(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	if err := adt.SetRollup("$typeof", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	old := env.Now().Add(-time.Hour)
+	adt.NewEvent("file").Time(old).Put()
+	adt.NewEvent("file").Time(old).Put()
+
+	if n := adt.ExpireRollup(); n != 0 {
+		t.Fatalf("expect old event held until window end , got %d", n)
+	}
+	rec.ExpectCount(t, "file", 1)
+
+	env.Clock.Advance(10 * time.Second)
+	if n := adt.ExpireRollup(); n != 1 {
+		t.Fatalf("expect 1 rollup event , got %d", n)
+	}
+	rec.ExpectCount(t, "file", 2)
+}
+
+func TestRollupFlushOnClose(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	if err := adt.SetRollup("$typeof", 60, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adt.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	adt.NewEvent("file").Put()
+	adt.NewEvent("file").Put()
+	if err := adt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rec.ExpectCount(t, "file", 2)
+
+	//停止事件不计入统计
+	st := adt.Stats()
+	if st.Uploaded != 2 || st.Latency.Count != 2 || len(st.Typeof) != 1 {
+		t.Fatalf("expect only file events counted , got %+v typeof %d", st.Counter, len(st.Typeof))
+	}
+}
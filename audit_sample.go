@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// sampleRule 非告警事件按照比例采样 告警事件全部保留
+// key 为空时随机采样 否则按照key的哈希采样 相同key的事件总是保留或者总是丢弃
+type sampleRule struct {
+	rate float64
+	key  *inhibit
+	when match
+}
+
+func newSampleRule(rate float64, tag string) *sampleRule {
+	r := &sampleRule{rate: rate}
+	if tag != "" {
+		r.key = newInhibit(tag)
+		r.key.compile()
+	}
+	return r
+}
+
+func (r *sampleRule) scope(ev *Event) bool {
+	if r.when == nil {
+		return true
+	}
+	return r.when(ev)
+}
+
+func (r *sampleRule) keep(ev *Event) bool {
+	if r.rate >= 1 {
+		return true
+	}
+
+	if r.key == nil {
+		return rand.Float64() < r.rate
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(r.key.Key(ev)))
+	return float64(h.Sum64()>>11)/(1<<53) < r.rate
+}
+
+// sample 返回false 表示事件被丢弃 保留的事件记录采样率
+func (a *Audit) sample(ev *Event, cfg *config) bool {
+	if ev.alert {
+		return true
+	}
+
+	for _, r := range cfg.sample {
+		if !r.scope(ev) {
+			continue
+		}
+
+		if !r.keep(ev) {
+			return false
+		}
+
+		ev.rate = r.rate
+		return true
+	}
+
+	return true
+}
@@ -0,0 +1,52 @@
+package audit_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSampleByKey(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	if err := adt.SetSample(0.5, "$user", "typeof = logger"); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func() {
+		for i := 0; i < 200; i++ {
+			adt.NewEvent("logger").User(fmt.Sprintf("u%d", i)).Put()
+		}
+	}
+
+	put()
+	kept := len(rec.Typeof("logger"))
+	if kept < 50 || kept > 150 {
+		t.Fatalf("expect about half of 200 kept , got %d", kept)
+	}
+
+	//按照key采样 相同的key结果相同
+	put()
+	rec.ExpectCount(t, "logger", 2*kept)
+
+	st := adt.Stats()
+	if int(st.Sampled) != 2*(200-kept) {
+		t.Fatalf("expect %d sampled , got %d", 2*(200-kept), st.Sampled)
+	}
+
+	for _, ev := range rec.Typeof("logger") {
+		if ev.Field("sample_rate") != "0.5" {
+			t.Fatalf("expect sample_rate 0.5 , got %q", ev.Field("sample_rate"))
+		}
+	}
+}
+
+func TestSampleKeepAlert(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	if err := adt.SetSample(0.01, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		adt.NewEvent("login").Alert().Put()
+	}
+	rec.ExpectCount(t, "login", 20)
+}
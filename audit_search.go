@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const tokenMax = 64
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWord(r rune) bool {
+	return !isCJK(r) && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// tokenize 英文数字按单词切分并转小写 中日韩文字按二元组切分 单独的汉字保留单字
+func tokenize(s string) []string {
+	var out []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			if w := strings.ToLower(string(word)); len(w) <= tokenMax {
+				out = append(out, w)
+			}
+			word = word[:0]
+		}
+	}
+
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+			return
+		case 1:
+			out = append(out, string(cjk))
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				out = append(out, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range s {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case isWord(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return out
+}
+
+// searchText 参与全文索引的字段
+func searchText(ev *Event) string {
+	text := ev.subject + "\n" + ev.msg
+	if ev.err != nil {
+		text += "\n" + ev.err.Error()
+	}
+	return text
+}
+
+// termsOf 去重之后的词 写入索引文件
+func termsOf(ev *Event) []string {
+	tokens := tokenize(searchText(ev))
+	seen := make(map[string]struct{}, len(tokens))
+	terms := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// searchTerm 查询中的一项 多个词组成的项需要在原文中验证连续出现
+type searchTerm struct {
+	tokens []string
+	prefix bool
+	phrase string
+}
+
+func (t searchTerm) verify() bool {
+	return len(t.tokens) > 1
+}
+
+/*
+	登录 失败            两个词都要出现
+	"password failed"   短语 按顺序连续出现
+	adm*                前缀
+*/
+
+func parseSearch(text string) ([]searchTerm, error) {
+	var terms []searchTerm
+	text = strings.TrimSpace(text)
+	for len(text) > 0 {
+		var raw string
+		if text[0] == '"' {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated phrase %s", text)
+			}
+			raw = text[1 : end+1]
+			text = text[end+2:]
+		} else {
+			end := strings.IndexFunc(text, unicode.IsSpace)
+			if end < 0 {
+				end = len(text)
+			}
+			raw = text[:end]
+			text = text[end:]
+		}
+		text = strings.TrimSpace(text)
+
+		t := searchTerm{}
+		if strings.HasSuffix(raw, "*") {
+			t.prefix = true
+			raw = strings.TrimRight(raw, "*")
+		}
+
+		t.tokens = tokenize(raw)
+		if len(t.tokens) == 0 {
+			continue
+		}
+		t.phrase = strings.ToLower(raw)
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// lookup 单个词的记录 前缀和单个汉字需要扫描词典
+func (sg *segment) lookup(token string, prefix bool) []int32 {
+	single := utf8.RuneCountInString(token) == 1 && isCJK([]rune(token)[0])
+	if !prefix && !single {
+		return sg.terms[token]
+	}
+
+	var lists [][]int32
+	for term, ids := range sg.terms {
+		if strings.HasPrefix(term, token) || (single && strings.Contains(term, token)) {
+			lists = append(lists, ids)
+		}
+	}
+	return union(lists)
+}
+
+func union(lists [][]int32) []int32 {
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+
+	var out []int32
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	n := 0
+	for i, id := range out {
+		if i == 0 || id != out[n-1] {
+			out[n] = id
+			n++
+		}
+	}
+	return out[:n]
+}
+
+// search 所有查询项都命中的记录 结果还需要 verify 过滤
+func (sg *segment) search(terms []searchTerm) []int32 {
+	var ids []int32
+	for i, t := range terms {
+		for j, token := range t.tokens {
+			list := sg.lookup(token, t.prefix && j == len(t.tokens)-1)
+			if i == 0 && j == 0 {
+				ids = append([]int32(nil), list...)
+			} else {
+				ids = intersect(ids, list)
+			}
+
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+	}
+	return ids
+}
+
+// verify 短语需要在原文中连续出现
+func verifySearch(ev *Event, terms []searchTerm) bool {
+	var text string
+	for _, t := range terms {
+		if !t.verify() {
+			continue
+		}
+
+		if text == "" {
+			text = strings.ToLower(searchText(ev))
+		}
+
+		if !strings.Contains(text, t.phrase) {
+			return false
+		}
+	}
+	return true
+}
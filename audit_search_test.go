@@ -0,0 +1,58 @@
+package audit_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestStoreSearch(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	adt.UseStore(t.TempDir())
+	start(t, adt)
+
+	adt.NewEvent("login").Subject("用户登录失败").Msg("password failed for admin").Put()
+	adt.NewEvent("login").Subject("用户登录成功").Msg("login ok for administrator").Put()
+	adt.NewEvent("user").Subject("password reset").Msg("failed password").Put()
+	adt.NewEvent("file").Subject("文件修改").Msg("/etc/passwd changed").Put()
+
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"登录", "用户登录失败,用户登录成功"},
+		{"登录失败", "用户登录失败"},
+		{"败", "用户登录失败"},
+		{"登录 ok", "用户登录成功"},
+		{"password failed", "password reset,用户登录失败"},
+		{`"password failed"`, "用户登录失败"},
+		{`"failed password"`, "password reset"},
+		{"PASSWORD", "password reset,用户登录失败"},
+		{"admin", "用户登录失败"},
+		{"adm*", "用户登录失败,用户登录成功"},
+		{"passw*", "password reset,文件修改,用户登录失败"},
+		{"nothing", ""},
+	}
+
+	for _, c := range cases {
+		evs, err := adt.Query(audit.Query{Text: c.text})
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		got := make([]string, 0, len(evs))
+		for _, ev := range evs {
+			got = append(got, ev.Field("subject"))
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != c.want {
+			t.Fatalf("search %s expect [%s] , got %v", c.text, c.want, got)
+		}
+	}
+
+	if _, err := adt.Query(audit.Query{Text: `"open`}); err == nil {
+		t.Fatal("expect unterminated phrase error")
+	}
+}
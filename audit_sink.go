@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Sink 审计事件的输出端 Go模块可以直接订阅事件 不需要经过lua
+type Sink interface {
+	Write(*Event) error
+	Close() error
+}
+
+// Filter 匹配成功的事件会被旁路 等同于 adt.pass
+type Filter interface {
+	Match(*Event) bool
+}
+
+type FilterFunc func(*Event) bool
+
+func (fn FilterFunc) Match(ev *Event) bool {
+	return fn(ev)
+}
+
+// hook Go代码注册的sink和filter 不受 audit.new{} 重新加载影响
+// 修改时只追加或者生成新的切片 不会改写已有的元素 读取时拿到切片之后就可以解锁
+// sink 和 filter 中可以调用 AddSink , RemoveSink , Put
+type hook struct {
+	mu      sync.RWMutex
+	sinks   []Sink
+	filters []Filter
+}
+
+// write 每个sink得到一份独立的拷贝 sink可能在其他协程中读取或者修改事件
+func (h *hook) write(ev *Event, fail func(error)) {
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+
+	for _, s := range sinks {
+		if err := s.Write(ev.snapshot()); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func (h *hook) match(ev *Event) bool {
+	h.mu.RLock()
+	filters := h.filters
+	h.mu.RUnlock()
+
+	for _, f := range filters {
+		if f.Match(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hook) remove(s Sink) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, item := range h.sinks {
+		if sameSink(item, s) {
+			h.sinks = append(h.sinks[:i:i], h.sinks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// sameSink 按照指针比较 不可比较的类型直接使用 == 会panic
+func sameSink(a, b Sink) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return false
+	}
+
+	if ta.Comparable() {
+		return a == b
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch va.Kind() {
+	case reflect.Func, reflect.Map, reflect.Slice:
+		return va.Pointer() == vb.Pointer()
+	}
+	return false
+}
+
+// replace 移除same匹配的sink之后追加s 返回被移除的sink
+func (h *hook) replace(s Sink, same func(Sink) bool) []Sink {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var old []Sink
+	sinks := h.sinks[:0:0]
+	for _, item := range h.sinks {
+		if same(item) {
+			old = append(old, item)
+			continue
+		}
+		sinks = append(sinks, item)
+	}
+	h.sinks = append(sinks, s)
+	return old
+}
+
+func (a *Audit) AddSink(s Sink) {
+	a.hook.mu.Lock()
+	a.hook.sinks = append(a.hook.sinks, s)
+	a.hook.mu.Unlock()
+}
+
+// RemoveSink 移除sink 并调用Close
+func (a *Audit) RemoveSink(s Sink) error {
+	if !a.hook.remove(s) {
+		return nil
+	}
+	return s.Close()
+}
+
+func (a *Audit) AddFilter(f Filter) {
+	a.hook.mu.Lock()
+	a.hook.filters = append(a.hook.filters, f)
+	a.hook.mu.Unlock()
+}
+
+// Subscribe 把事件投递到ch 通道满的时候直接丢弃 不会阻塞 handle
+// 返回的cancel 用来取消订阅 不会关闭ch
+func (a *Audit) Subscribe(ch chan<- *Event) (cancel func()) {
+	s := &chanSink{ch: ch}
+	a.AddSink(s)
+	return func() {
+		a.RemoveSink(s)
+	}
+}
+
+type chanSink struct {
+	ch chan<- *Event
+}
+
+func (c *chanSink) Write(ev *Event) error {
+	select {
+	case c.ch <- ev:
+	default:
+	}
+	return nil
+}
+
+func (c *chanSink) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+// reentrantSink 在 Write 中取消自己 并且提交新的事件
+type reentrantSink struct {
+	adt   *audit.Audit
+	calls int
+}
+
+func (s *reentrantSink) Write(ev *audit.Event) error {
+	s.calls++
+	s.adt.RemoveSink(s)
+	s.adt.NewEvent("followup").Put()
+	return nil
+}
+
+func (s *reentrantSink) Close() error { return nil }
+
+func TestSinkReentrant(t *testing.T) {
+	adt, _, rec := newAudit(t)
+
+	s := &reentrantSink{adt: adt}
+	adt.AddSink(s)
+	adt.AddFilter(audit.FilterFunc(func(ev *audit.Event) bool {
+		adt.AddFilter(audit.FilterFunc(func(*audit.Event) bool { return false }))
+		return false
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		adt.NewEvent("login").Put()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink calling RemoveSink and Put deadlocked")
+	}
+
+	rec.ExpectEvent(t, "login")
+	rec.ExpectEvent(t, "followup")
+	if s.calls != 1 {
+		t.Fatalf("expect removed sink called once , got %d", s.calls)
+	}
+}
+
+// 通道满的时候丢弃 cancel 之后不再投递 也不关闭通道
+func TestSubscribeChan(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	ch := make(chan *audit.Event, 2)
+	cancel := adt.Subscribe(ch)
+
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("login").Put()
+	}
+	if len(ch) != 2 {
+		t.Fatalf("expect 2 events in channel , got %d", len(ch))
+	}
+
+	<-ch
+	<-ch
+	cancel()
+	adt.NewEvent("login").Put()
+
+	select {
+	case ev, ok := <-ch:
+		t.Fatalf("expect no event after cancel , got %v %v", ev, ok)
+	default:
+	}
+}
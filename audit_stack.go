@@ -1,16 +1,17 @@
 package audit
 
 import (
-	"github.com/vela-security/vela-public/catch"
+	"fmt"
 	"github.com/vela-security/vela-public/lua"
 )
 
+// RecoverByCodeVM msg 记录panic的值 调用栈只在 error.stack 中记录一次
 func RecoverByCodeVM(L *lua.LState, ev *Event) {
 	r := recover()
 	if r == nil {
 		return
 	}
-	ev.Subject("进程服务异常").From(L.CodeVM()).Msg(catch.StackTrace(0)).Log().Put()
+	ev.Subject("进程服务异常").From(L.CodeVM()).Msg("%v", r).E(panicError(r)).Stack().Log().Put()
 }
 
 func Recover(ev *Event) {
@@ -18,5 +19,13 @@ func Recover(ev *Event) {
 	if r == nil {
 		return
 	}
-	ev.Subject("进程异常").Msg(catch.StackTrace(0)).Log().Put()
+	ev.Subject("进程异常").Msg("%v", r).E(panicError(r)).Stack().Log().Put()
+}
+
+// panicError recover 得到的值 本身是error时保留包装链
+func panicError(r interface{}) error {
+	if e, ok := r.(error); ok {
+		return fmt.Errorf("panic: %w", e)
+	}
+	return &causeError{msg: fmt.Sprintf("panic: %v", r), typ: "panic"}
 }
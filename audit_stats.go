@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	mPut = iota
+	mDropped
+	mBypass
+	mSampled
+	mRolled
+	mInhibited
+	mUploaded
+	mFailed
+	mMetrics
+)
+
+const maxSeries = 256
+
+// 超过 maxSeries 的 typeof , level , from 合并到一起 避免基数膨胀
+const otherSeries = "_other"
+
+var latencyBounds = [...]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Counter 审计流程各个阶段的事件数量
+type Counter struct {
+	Put       uint64 `json:"put"`
+	Dropped   uint64 `json:"dropped"`
+	Bypass    uint64 `json:"bypass"`
+	Sampled   uint64 `json:"sampled"`
+	Rolled    uint64 `json:"rolled"`
+	Inhibited uint64 `json:"inhibited"`
+	Uploaded  uint64 `json:"uploaded"`
+	Failed    uint64 `json:"failed"`
+}
+
+func (c Counter) Sub(prev Counter) Counter {
+	return Counter{
+		Put:       c.Put - prev.Put,
+		Dropped:   c.Dropped - prev.Dropped,
+		Bypass:    c.Bypass - prev.Bypass,
+		Sampled:   c.Sampled - prev.Sampled,
+		Rolled:    c.Rolled - prev.Rolled,
+		Inhibited: c.Inhibited - prev.Inhibited,
+		Uploaded:  c.Uploaded - prev.Uploaded,
+		Failed:    c.Failed - prev.Failed,
+	}
+}
+
+// Histogram handle 处理耗时 Counts 比 Bounds 多一个 +Inf 桶 单位秒
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+type Series struct {
+	Counter
+	Latency Histogram `json:"latency"`
+}
+
+// Stats 审计流程的计数快照 SpoolDropped 上传失败并且没有写入spool的事件数
+type Stats struct {
+	Series
+	SpoolDropped uint64            `json:"spool_dropped"`
+	Typeof       map[string]Series `json:"typeof"`
+	Level        map[string]Series `json:"level"`
+	From         map[string]Series `json:"from"`
+}
+
+type series struct {
+	count  [mMetrics]uint64
+	bucket [len(latencyBounds) + 1]uint64
+	total  uint64
+	sum    float64
+}
+
+func (s *series) observe(d time.Duration) {
+	v := d.Seconds()
+	idx := len(latencyBounds)
+	for i, b := range latencyBounds {
+		if v <= b {
+			idx = i
+			break
+		}
+	}
+
+	s.bucket[idx]++
+	s.total++
+	s.sum += v
+}
+
+func (s *series) snapshot() Series {
+	return Series{
+		Counter: Counter{
+			Put:       s.count[mPut],
+			Dropped:   s.count[mDropped],
+			Bypass:    s.count[mBypass],
+			Sampled:   s.count[mSampled],
+			Rolled:    s.count[mRolled],
+			Inhibited: s.count[mInhibited],
+			Uploaded:  s.count[mUploaded],
+			Failed:    s.count[mFailed],
+		},
+		Latency: Histogram{
+			Bounds: latencyBounds[:],
+			Counts: append([]uint64(nil), s.bucket[:]...),
+			Count:  s.total,
+			Sum:    s.sum,
+		},
+	}
+}
+
+type stats struct {
+	mu     sync.Mutex
+	total  series
+	typeof map[string]*series
+	level  map[string]*series
+	from   map[string]*series
+}
+
+func newStats() *stats {
+	return &stats{
+		typeof: make(map[string]*series),
+		level:  make(map[string]*series),
+		from:   make(map[string]*series),
+	}
+}
+
+func lookup(m map[string]*series, key string) *series {
+	s, ok := m[key]
+	if ok {
+		return s
+	}
+
+	if len(m) >= maxSeries {
+		key = otherSeries
+		if s, ok = m[key]; ok {
+			return s
+		}
+	}
+
+	s = &series{}
+	m[key] = s
+	return s
+}
+
+func (st *stats) each(ev *Event, fn func(*series)) {
+	fn(&st.total)
+	fn(lookup(st.typeof, ev.typeof))
+	fn(lookup(st.level, ev.level.Label(LangZH)))
+	fn(lookup(st.from, ev.from))
+}
+
+// incr 心跳和停止事件记录的就是这些计数 不再计入
+func (st *stats) incr(ev *Event, metric int) {
+	if ev.internal {
+		return
+	}
+
+	st.mu.Lock()
+	st.each(ev, func(s *series) { s.count[metric]++ })
+	st.mu.Unlock()
+}
+
+// observe 聚合的事件在合并时统计一次 窗口结束输出时不再统计
+func (st *stats) observe(ev *Event, begin time.Time) {
+	if ev.internal || ev.held {
+		return
+	}
+
+	d := time.Since(begin)
+	st.mu.Lock()
+	st.each(ev, func(s *series) { s.observe(d) })
+	st.mu.Unlock()
+}
+
+func (st *stats) counter() Counter {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.total.snapshot().Counter
+}
+
+func (st *stats) snapshot() Stats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	dump := func(m map[string]*series) map[string]Series {
+		out := make(map[string]Series, len(m))
+		for k, s := range m {
+			out[k] = s.snapshot()
+		}
+		return out
+	}
+
+	return Stats{
+		Series: st.total.snapshot(),
+		Typeof: dump(st.typeof),
+		Level:  dump(st.level),
+		From:   dump(st.from),
+	}
+}
+
+// Stats 审计流程计数快照 按照 typeof , level , from 分类
+func (a *Audit) Stats() Stats {
+	st := a.stat.snapshot()
+	st.SpoolDropped = a.dlv.droppedCount()
+	return st
+}
+
+// heartbeatLoop 按照 heartbeat 配置的间隔发出心跳事件 记录两次心跳之间的计数变化
+func (a *Audit) heartbeatLoop(stop chan struct{}) {
+	tk := time.NewTicker(time.Second)
+	defer tk.Stop()
+
+	last := time.Now()
+	prev := a.stat.counter()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-tk.C:
+			cfg := a.config()
+			if cfg.heartbeat <= 0 || now.Sub(last) < time.Duration(cfg.heartbeat)*time.Second {
+				continue
+			}
+
+			cur := a.stat.counter()
+			a.heartbeat(cur.Sub(prev), now.Sub(last))
+			prev = cur
+			last = now
+		}
+	}
+}
+
+func (a *Audit) heartbeat(delta Counter, interval time.Duration) {
+	ev := a.NewEvent("audit").Subject("审计服务心跳").From(a.Name())
+	ev.Msg("interval:%s %s", interval.Round(time.Second), delta.String())
+	delta.attr(ev)
+	ev.upload = true
+	ev.rolled = true
+	ev.internal = true
+	a.handle(ev)
+}
+
+func (c Counter) String() string {
+	return fmt.Sprintf("put:%d dropped:%d bypass:%d sampled:%d rolled:%d inhibited:%d uploaded:%d failed:%d",
+		c.Put, c.Dropped, c.Bypass, c.Sampled, c.Rolled, c.Inhibited, c.Uploaded, c.Failed)
+}
+
+func (c Counter) attr(ev *Event) {
+	ev.Attr("put", c.Put)
+	ev.Attr("dropped", c.Dropped)
+	ev.Attr("bypass", c.Bypass)
+	ev.Attr("sampled", c.Sampled)
+	ev.Attr("rolled", c.Rolled)
+	ev.Attr("inhibited", c.Inhibited)
+	ev.Attr("uploaded", c.Uploaded)
+	ev.Attr("failed", c.Failed)
+}
@@ -0,0 +1,576 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storeDayLayout = "20060102"
+	storeCache     = 4
+	storeLimit     = 100
+	storeIndex     = 200000
+)
+
+// storeFields 建立索引的字段 顺序和索引文件中的k一致
+var storeFields = []string{"typeof", "level", "user", "remote_addr", "from"}
+
+// Query 本地事件查询条件 为空的字段不参与过滤 结果按时间倒序
+type Query struct {
+	Since      time.Time
+	Until      time.Time
+	Typeof     string
+	Level      string // 等级名称或者数值 索引中保存的是中文名称
+	User       string
+	RemoteAddr string
+	From       string
+	Text       string
+	Limit      int
+}
+
+func (q Query) values() []string {
+	level := q.Level
+	if sev, ok := ParseSeverity(level); ok {
+		level = sev.Label(LangZH)
+	}
+	return []string{q.Typeof, level, q.User, q.RemoteAddr, q.From}
+}
+
+type storeRec struct {
+	off  int64
+	size int
+	time int64
+}
+
+// storeLine 索引文件的一行 数据文件只追加 索引文件记录偏移和索引字段
+type storeLine struct {
+	Off   int64    `json:"o"`
+	Size  int      `json:"n"`
+	Time  int64    `json:"t"`
+	Keys  []string `json:"k"`
+	Words []string `json:"w"`
+}
+
+// segment 一天的事件 数据文件 YYYYMMDD.evt 索引文件 YYYYMMDD.idx
+// 写入只追加文件 内存索引在查询时才从索引文件加载
+type segment struct {
+	day    string
+	data   *os.File
+	idx    *os.File
+	size   int64
+	loaded bool
+	recs   []storeRec
+	post   map[string][]int32
+	terms  map[string][]int32
+	used   time.Time
+}
+
+func storeDay(t time.Time) string {
+	return t.Local().Format(storeDayLayout)
+}
+
+func postKey(field int, val string) string {
+	return strconv.Itoa(field) + ":" + val
+}
+
+func (sg *segment) index(rec storeRec, keys, words []string) {
+	id := int32(len(sg.recs))
+	sg.recs = append(sg.recs, rec)
+	for i, k := range keys {
+		if k == "" || i >= len(storeFields) {
+			continue
+		}
+		key := postKey(i, k)
+		sg.post[key] = append(sg.post[key], id)
+	}
+
+	for _, w := range words {
+		sg.terms[w] = append(sg.terms[w], id)
+	}
+}
+
+func storeKeys(ev *Event) []string {
+	keys := make([]string, len(storeFields))
+	for i, f := range storeFields {
+		keys[i] = ev.Field(f)
+	}
+	return keys
+}
+
+func openSegment(dir, day string) (*segment, error) {
+	base := filepath.Join(dir, day)
+	data, err := os.OpenFile(base+".evt", os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := os.OpenFile(base+".idx", os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	sg := &segment{day: day, data: data, idx: idx}
+	if err = sg.scan(nil); err != nil {
+		sg.close()
+		return nil, err
+	}
+	return sg, nil
+}
+
+// load 查询时建立内存索引 已经加载的直接使用
+func (sg *segment) load() error {
+	if sg.loaded {
+		return nil
+	}
+
+	sg.reset()
+	sg.loaded = true
+	if err := sg.scan(sg.index); err != nil {
+		sg.unload()
+		return err
+	}
+	return nil
+}
+
+// unload 释放内存索引 文件保持打开 继续写入
+func (sg *segment) unload() {
+	sg.loaded = false
+	sg.recs = nil
+	sg.post = nil
+	sg.terms = nil
+}
+
+// scan 读取索引 数据文件比索引多出来的部分说明上次写索引前退出 重新补齐
+func (sg *segment) scan(fn func(storeRec, []string, []string)) error {
+	st, err := sg.data.Stat()
+	if err != nil {
+		return err
+	}
+	sg.size = st.Size()
+
+	if _, err = sg.idx.Seek(0, 0); err != nil {
+		return err
+	}
+
+	var end int64
+	sc := bufio.NewScanner(sg.idx)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var line storeLine
+		if json.Unmarshal(sc.Bytes(), &line) != nil {
+			continue
+		}
+
+		//数据文件被截断 或者旧版本没有全文索引 重建索引
+		if line.Off+int64(line.Size) > sg.size || line.Words == nil {
+			return sg.rebuild()
+		}
+		if fn != nil {
+			fn(storeRec{off: line.Off, size: line.Size, time: line.Time}, line.Keys, line.Words)
+		}
+		end = line.Off + int64(line.Size) + 1
+	}
+
+	if end >= sg.size {
+		return nil
+	}
+	return sg.repair(end)
+}
+
+func (sg *segment) rebuild() error {
+	if err := sg.idx.Truncate(0); err != nil {
+		return err
+	}
+	if sg.loaded {
+		sg.reset()
+	}
+	return sg.repair(0)
+}
+
+func (sg *segment) reset() {
+	sg.recs = nil
+	sg.post = make(map[string][]int32)
+	sg.terms = make(map[string][]int32)
+}
+
+func (sg *segment) repair(end int64) error {
+	if _, err := sg.data.Seek(end, 0); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(sg.data)
+	off := end
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			if ev, e := DecodeEvent(line); e == nil {
+				sg.writeIndex(storeRec{off: off, size: len(line) - 1, time: ev.time.UnixNano()}, ev)
+			}
+		}
+		off += int64(len(line))
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (sg *segment) writeIndex(rec storeRec, ev *Event) {
+	keys, words := storeKeys(ev), termsOf(ev)
+	line, _ := json.Marshal(storeLine{Off: rec.off, Size: rec.size, Time: rec.time, Keys: keys, Words: words})
+	sg.idx.Write(append(line, '\n'))
+	if sg.loaded {
+		sg.index(rec, keys, words)
+	}
+}
+
+func (sg *segment) append(ev *Event) error {
+	raw := ev.Byte()
+	n, err := sg.data.Write(append(raw, '\n'))
+	if err != nil {
+		return err
+	}
+
+	rec := storeRec{off: sg.size, size: len(raw), time: ev.time.UnixNano()}
+	sg.size += int64(n)
+	sg.writeIndex(rec, ev)
+	return nil
+}
+
+// match 命中所有条件的记录 没有条件时返回全部
+func (sg *segment) match(values []string) []int32 {
+	var ids []int32
+	filtered := false
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+
+		list := sg.post[postKey(i, v)]
+		if !filtered {
+			ids = append([]int32(nil), list...)
+			filtered = true
+		} else {
+			ids = intersect(ids, list)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+	}
+
+	if filtered {
+		return ids
+	}
+
+	ids = make([]int32, len(sg.recs))
+	for i := range ids {
+		ids[i] = int32(i)
+	}
+	return ids
+}
+
+func intersect(a, b []int32) []int32 {
+	out := a[:0]
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+func (sg *segment) read(rec storeRec) (*Event, error) {
+	buf := make([]byte, rec.size)
+	if _, err := sg.data.ReadAt(buf, rec.off); err != nil {
+		return nil, err
+	}
+	return DecodeEvent(buf)
+}
+
+func (sg *segment) close() {
+	sg.data.Close()
+	sg.idx.Close()
+}
+
+// store 按天分区的本地事件存储 只追加 超过保留天数的分区整体删除
+// 内存索引的记录总数不超过storeIndex 超过时释放最久没有使用的分区索引
+type store struct {
+	mu        sync.Mutex
+	dir       string
+	retention int
+	segs      map[string]*segment
+	now       func() time.Time
+}
+
+func newStore(now func() time.Time) *store {
+	return &store{segs: make(map[string]*segment), now: now}
+}
+
+func (s *store) open(dir string, retention int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeAll()
+	s.dir = dir
+	s.retention = retention
+	if dir == "" {
+		return nil
+	}
+	return os.MkdirAll(dir, 0700)
+}
+
+func (s *store) closeAll() {
+	for day, sg := range s.segs {
+		sg.close()
+		delete(s.segs, day)
+	}
+}
+
+func (s *store) close() {
+	s.mu.Lock()
+	s.closeAll()
+	s.dir = ""
+	s.mu.Unlock()
+}
+
+// segment 打开的分区超过storeCache时关闭最久没有使用的
+func (s *store) segment(day string, create bool) (*segment, error) {
+	if sg, ok := s.segs[day]; ok {
+		sg.used = s.now()
+		return sg, nil
+	}
+
+	if !create {
+		if _, err := os.Stat(filepath.Join(s.dir, day+".evt")); err != nil {
+			return nil, nil
+		}
+	}
+
+	sg, err := openSegment(s.dir, day)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.segs) >= storeCache {
+		var old *segment
+		for _, item := range s.segs {
+			if old == nil || item.used.Before(old.used) {
+				old = item
+			}
+		}
+		old.close()
+		delete(s.segs, old.day)
+	}
+
+	sg.used = s.now()
+	s.segs[day] = sg
+	return sg, nil
+}
+
+func (s *store) append(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		return nil
+	}
+
+	sg, err := s.segment(storeDay(ev.time), true)
+	if err != nil {
+		return err
+	}
+
+	err = sg.append(ev)
+	if sg.loaded {
+		s.trim()
+	}
+	return err
+}
+
+func (s *store) trim() {
+	for {
+		total := 0
+		var old *segment
+		for _, sg := range s.segs {
+			if !sg.loaded {
+				continue
+			}
+			total += len(sg.recs)
+			if old == nil || sg.used.Before(old.used) {
+				old = sg
+			}
+		}
+
+		if old == nil || total <= storeIndex {
+			return
+		}
+		old.unload()
+	}
+}
+
+// days 已有的分区 从新到旧
+func (s *store) days() []string {
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*.evt"))
+	days := make([]string, 0, len(files))
+	for _, f := range files {
+		day := strings.TrimSuffix(filepath.Base(f), ".evt")
+		if _, err := time.Parse(storeDayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days
+}
+
+func (s *store) query(q Query) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" {
+		return nil, fmt.Errorf("event store not enabled")
+	}
+	defer s.trim()
+
+	if q.Limit <= 0 {
+		q.Limit = storeLimit
+	}
+
+	since, until := int64(0), int64(1<<63-1)
+	if !q.Since.IsZero() {
+		since = q.Since.UnixNano()
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.UnixNano()
+	}
+
+	terms, err := parseSearch(q.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	values := q.values()
+	var out []*Event
+	for _, day := range s.days() {
+		if !q.Since.IsZero() && day < storeDay(q.Since) {
+			break
+		}
+		if !q.Until.IsZero() && day > storeDay(q.Until) {
+			continue
+		}
+
+		sg, err := s.segment(day, false)
+		if err != nil {
+			return out, err
+		}
+		if sg == nil {
+			continue
+		}
+
+		if err = sg.load(); err != nil {
+			return out, err
+		}
+
+		ids := sg.match(values)
+		if len(terms) > 0 && len(ids) > 0 {
+			ids = intersect(ids, sg.search(terms))
+		}
+		recs := make([]storeRec, 0, len(ids))
+		for _, id := range ids {
+			rec := sg.recs[id]
+			if rec.time >= since && rec.time <= until {
+				recs = append(recs, rec)
+			}
+		}
+
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].time > recs[j].time })
+		for _, rec := range recs {
+			ev, err := sg.read(rec)
+			if err != nil || !verifySearch(ev, terms) {
+				continue
+			}
+
+			out = append(out, ev)
+			if len(out) >= q.Limit {
+				return out, nil
+			}
+		}
+		s.trim()
+	}
+	return out, nil
+}
+
+// expire 删除超过保留天数的分区
+func (s *store) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir == "" || s.retention <= 0 {
+		return
+	}
+
+	edge := storeDay(s.now().AddDate(0, 0, -s.retention))
+	for _, day := range s.days() {
+		if day >= edge {
+			continue
+		}
+
+		if sg, ok := s.segs[day]; ok {
+			sg.close()
+			delete(s.segs, day)
+		}
+
+		base := filepath.Join(s.dir, day)
+		os.Remove(base + ".evt")
+		os.Remove(base + ".idx")
+	}
+}
+
+// Query 查询本地存储的事件 结果按时间倒序
+func (a *Audit) Query(q Query) ([]*Event, error) {
+	evs, err := a.db.query(q)
+	for _, ev := range evs {
+		ev.adt = a
+	}
+	return evs, err
+}
+
+// parseSince 支持 30m , 1h , 7d 这样的相对时间 或者绝对时间
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if strings.HasSuffix(v, "d") {
+		if n, err := strconv.Atoi(v[:len(v)-1]); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if tm, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s", v)
+}
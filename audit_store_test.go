@@ -0,0 +1,36 @@
+package audit_test
+
+import (
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestStoreQuery(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	dir := t.TempDir()
+	adt.UseStore(dir)
+	start(t, adt)
+
+	adt.NewEvent("login").User("root").Msg("password failed").Put()
+	adt.NewEvent("login").User("admin").Msg("login ok").Put()
+	adt.NewEvent("logout").User("root").Msg("bye").Put()
+
+	evs, err := adt.Query(audit.Query{User: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 2 {
+		t.Fatalf("expect 2 events of root , got %d", len(evs))
+	}
+
+	// 已经加载索引的分区 继续写入的事件也能查到
+	adt.NewEvent("login").User("root").Msg("password failed again").Put()
+	evs, err = adt.Query(audit.Query{Typeof: "login", Text: `"password failed"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 2 {
+		t.Fatalf("expect 2 events of password failed , got %d", len(evs))
+	}
+}
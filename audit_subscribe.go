@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/vela-security/vela-public/lua"
+	"sync"
+	"sync/atomic"
+)
+
+const subscribeBuffer = 256
+
+// subscriber lua订阅 在独立的虚拟机里执行回调 缓冲区满的时候丢弃事件 不阻塞 handle
+type subscriber struct {
+	adt     *Audit
+	vm      string
+	expr    string
+	when    match
+	fn      *lua.LFunction
+	co      *lua.LState
+	ch      chan *Event
+	stop    chan struct{}
+	once    sync.Once
+	drain   bool
+	dropped uint64
+	called  uint64
+}
+
+func newSubscriber(adt *Audit, vm, expr string, when match, fn *lua.LFunction, co *lua.LState) *subscriber {
+	s := &subscriber{
+		adt:  adt,
+		vm:   vm,
+		expr: expr,
+		when: when,
+		fn:   fn,
+		co:   co,
+		ch:   make(chan *Event, subscribeBuffer),
+		stop: make(chan struct{}),
+	}
+
+	go s.loop()
+	return s
+}
+
+// Write hook.write 传入的是事件快照 回调里修改字段不会影响其他sink和输出
+func (s *subscriber) Write(ev *Event) error {
+	if s.when != nil && !s.when(ev) {
+		return nil
+	}
+
+	select {
+	case s.ch <- ev:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+func (s *subscriber) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+// shutdown 审计对象关闭 执行完缓冲中的事件后退出 订阅不会自动恢复
+func (s *subscriber) shutdown() {
+	s.once.Do(func() {
+		s.drain = true
+		close(s.stop)
+	})
+	s.adt.environ().Debugf("audit subscribe %s closed with %s , subscribe again after start", s.expr, s.adt.Name())
+}
+
+func (s *subscriber) closed() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// loop 退出时关闭克隆的虚拟机
+func (s *subscriber) loop() {
+	defer s.co.Close()
+
+	for {
+		select {
+		case <-s.stop:
+			if s.drain {
+				s.flush()
+			}
+			return
+		case ev := <-s.ch:
+			s.call(ev)
+		}
+	}
+}
+
+func (s *subscriber) flush() {
+	for {
+		select {
+		case ev := <-s.ch:
+			s.call(ev)
+		default:
+			return
+		}
+	}
+}
+
+func (s *subscriber) call(ev *Event) {
+	atomic.AddUint64(&s.called, 1)
+	err := s.co.CallByParam(lua.P{
+		Fn:      s.fn,
+		NRet:    0,
+		Protect: true,
+	}, ev)
+
+	if err != nil {
+		s.adt.environ().Errorf("audit subscribe %s callback fail %v", s.expr, err)
+	}
+}
+
+func (s *subscriber) cancelL(L *lua.LState) int {
+	L.Push(lua.LBool(s.adt.hook.remove(s)))
+	s.Close()
+	return 1
+}
+
+func (s *subscriber) String() string                         { return fmt.Sprintf("audit.subscribe(%s)", s.expr) }
+func (s *subscriber) Type() lua.LValueType                   { return lua.LTObject }
+func (s *subscriber) AssertFloat64() (float64, bool)         { return 0, false }
+func (s *subscriber) AssertString() (string, bool)           { return "", false }
+func (s *subscriber) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (s *subscriber) Peek() lua.LValue                       { return s }
+
+func (s *subscriber) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "cancel":
+		return lua.NewFunction(s.cancelL)
+	case "vm":
+		return lua.S2L(s.vm)
+	case "expr":
+		return lua.S2L(s.expr)
+	case "pending":
+		return lua.LInt(len(s.ch))
+	case "dropped":
+		return lua.LNumber(atomic.LoadUint64(&s.dropped))
+	case "called":
+		return lua.LNumber(atomic.LoadUint64(&s.called))
+	case "closed":
+		return lua.LBool(s.closed())
+	}
+	return lua.LNil
+}
+
+// addSubscriber 同一个脚本相同表达式的订阅会替换之前的 脚本重新加载时不会重复订阅
+func (a *Audit) addSubscriber(s *subscriber) {
+	old := a.hook.replace(s, func(item Sink) bool {
+		o, ok := item.(*subscriber)
+		return ok && o.vm == s.vm && o.expr == s.expr
+	})
+
+	for _, o := range old {
+		o.Close()
+	}
+}
+
+/*
+	local sub = adt.subscribe("typeof = login && level >= 重要" , function(ev)
+		print(ev.msg)
+	end)
+	sub.cancel()
+*/
+
+func (a *Audit) subscribeL(L *lua.LState) int {
+	expr := L.CheckString(1)
+	fn := L.CheckFunction(2)
+
+	var when match
+	if expr != "" && expr != "*" {
+		when = checkCondition(L, expr)
+	}
+
+	s := newSubscriber(a, L.CodeVM(), expr, when, fn, xEnv.Clone(L))
+	a.addSubscriber(s)
+	L.Push(s)
+	return 1
+}
+
+// subscribeL 全局的 adt.subscribe 任意脚本都可以订阅
+func subscribeL(L *lua.LState) int {
+	adt := CheckAdt()
+	if adt == nil {
+		L.RaiseError("not found audit object")
+		return 0
+	}
+	return adt.subscribeL(L)
+}
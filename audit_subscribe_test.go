@@ -0,0 +1,79 @@
+package audit_test
+
+import (
+	"testing"
+)
+
+func TestSubscribeFilter(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	sub, err := adt.SubscribeBuffer("a.lua", "typeof = login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := adt.SubscribeBuffer("a.lua", "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adt.NewEvent("login").Put()
+	adt.NewEvent("logout").Put()
+
+	if sub.Pending() != 1 || all.Pending() != 2 {
+		t.Fatalf("expect pending 1 and 2 , got %d %d", sub.Pending(), all.Pending())
+	}
+}
+
+// 缓冲满的时候丢弃 不阻塞 handle
+func TestSubscribeDropWhenFull(t *testing.T) {
+	adt, _, rec := newAudit(t)
+
+	sub, err := adt.SubscribeBuffer("a.lua", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 300; i++ {
+		adt.NewEvent("login").Put()
+	}
+
+	rec.ExpectCount(t, "login", 300)
+	if sub.Pending() != 256 || sub.Dropped() != 44 {
+		t.Fatalf("expect pending 256 dropped 44 , got %d %d", sub.Pending(), sub.Dropped())
+	}
+}
+
+// 同一个脚本相同的表达式重新订阅 替换并关闭之前的订阅
+func TestSubscribeReplace(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	old, _ := adt.SubscribeBuffer("a.lua", "typeof = login")
+	other, _ := adt.SubscribeBuffer("b.lua", "typeof = login")
+	sub, _ := adt.SubscribeBuffer("a.lua", "typeof = login")
+
+	if !old.Closed() || other.Closed() || sub.Closed() {
+		t.Fatalf("expect only old closed , got %v %v %v", old.Closed(), other.Closed(), sub.Closed())
+	}
+
+	adt.NewEvent("login").Put()
+	if old.Pending() != 0 || other.Pending() != 1 || sub.Pending() != 1 {
+		t.Fatalf("expect pending 0 1 1 , got %d %d %d", old.Pending(), other.Pending(), sub.Pending())
+	}
+}
+
+// 审计对象关闭时订阅一起关闭 不会自动恢复
+func TestSubscribeCloseWithAudit(t *testing.T) {
+	adt, _, _ := newAudit(t)
+	if err := adt.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, _ := adt.SubscribeBuffer("a.lua", "")
+	if err := adt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sub.Closed() {
+		t.Fatal("expect subscribe closed with audit")
+	}
+}
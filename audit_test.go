@@ -0,0 +1,47 @@
+package audit_test
+
+import (
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+	"github.com/vela-security/vela-audit/audittest"
+)
+
+// newAudit 内存环境的审计对象 文件都写在测试的临时目录下
+func newAudit(t *testing.T, opts ...audittest.Option) (*audit.Audit, *audittest.Env, *audittest.Recorder) {
+	t.Helper()
+
+	adt, env, rec := audittest.New(opts...)
+	adt.UseTestConfig(t.TempDir())
+	return adt, env, rec
+}
+
+// start 需要 spool 和 ack 文件的测试调用 测试结束时关闭
+func start(t *testing.T, adt *audit.Audit) {
+	t.Helper()
+
+	if err := adt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { adt.Close() })
+}
+
+func TestPutUpload(t *testing.T) {
+	adt, env, rec := newAudit(t)
+
+	adt.NewEvent("login").User("root").Remote("10.0.0.1").Subject("登录成功").Put()
+
+	ev := rec.ExpectEvent(t, "login")
+	audittest.ExpectField(t, ev, "user", "root")
+	audittest.ExpectField(t, ev, "id", audittest.ID)
+
+	up := env.Tunnel.ExpectUpload(t, "login")
+	if up["event_id"] != ev.EventID() {
+		t.Fatalf("expect upload event_id %s , got %v", ev.EventID(), up["event_id"])
+	}
+
+	st := adt.Stats()
+	if st.Put != 1 || st.Uploaded != 1 {
+		t.Fatalf("expect put 1 uploaded 1 , got %+v", st.Counter)
+	}
+}
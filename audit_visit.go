@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/vela-security/vela-public/lua"
+	"io"
+	"sync/atomic"
 	"time"
 )
 
 func (a *Audit) Name() string {
-	return a.cfg.name
+	return a.config().name
 }
 
 func (a *Audit) E(err error) {
@@ -16,28 +18,132 @@ func (a *Audit) E(err error) {
 		return
 	}
 
-	xEnv.Errorf("vela audit handle fail , error: %v", err)
+	a.environ().Errorf("vela audit handle fail , error: %v", err)
 }
 
+// Close 停止接收事件 在deadline内等待处理中的事件 输出聚合事件并重试spool
+// 保存限速状态 发出停止事件之后关闭所有sink 通过 AddSink 注册的sink 需要重新注册
 func (a *Audit) Close() error {
 	if !a.IsRun() {
 		return errors.New(a.Name() + "can't close , err: is close")
 	}
 
-	a.V(lua.PTClose)
-	if a.fd != nil {
-		a.fd.Close()
+	env := a.environ()
+	cfg := a.config()
+	atomic.StoreInt32(&a.closing, 1)
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+
+	//后台协程可能正在 handle 或者 retry 等它们退出之后再释放资源
+	a.loops.Wait()
+
+	deadline := time.Now().Add(time.Duration(cfg.deadline) * time.Second)
+	for atomic.LoadInt64(&a.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.Flush()
+
+	if time.Now().Before(deadline) {
+		if _, err := a.dlv.retry(env); err != nil {
+			env.Errorf("%s spool retry fail %v", a.Name(), err)
+		}
 	}
 
-	a.cfg = velaMinConfig()
+	if cfg.inhibitFile != "" {
+		if err := a.mem.dump(cfg.inhibitFile); err != nil {
+			env.Errorf("%s save inhibit state fail %v", a.Name(), err)
+		}
+	}
+
+	a.stopped()
+	a.serveMetrics("")
+	a.closeSink()
+	a.dlv.close()
+	a.db.close()
+	a.swapFile(nil)
+
+	a.V(lua.PTClose)
+	a.mu.Lock()
+	a.config().co.close()
+	a.cfg.Store(velaMinConfig())
+	a.mu.Unlock()
 	return nil
 }
 
+// stopped 最后一条事件 记录本次运行的计数
+func (a *Audit) stopped() {
+	c := a.stat.counter()
+	ev := a.NewEvent("audit").Subject("审计服务停止").From(a.Name())
+	ev.Msg("%s", c.String())
+	c.attr(ev)
+	ev.upload = true
+	ev.rolled = true
+	ev.internal = true
+	a.handle(ev)
+}
+
+// closeSink 关闭通过 AddSink 注册的sink to 配置的writer 刷新之后关闭
+func (a *Audit) closeSink() {
+	a.hook.mu.Lock()
+	sinks := a.hook.sinks
+	a.hook.sinks = nil
+	a.hook.mu.Unlock()
+
+	for _, s := range sinks {
+		if sub, ok := s.(*subscriber); ok {
+			sub.shutdown()
+			continue
+		}
+		a.E(s.Close())
+	}
+
+	sdk := a.config().sdk
+	if f, ok := sdk.(interface{ Flush() error }); ok {
+		a.E(f.Flush())
+	}
+
+	if c, ok := sdk.(io.Closer); ok {
+		a.E(c.Close())
+	}
+}
+
+// spawn 启动后台协程 Close 时等待退出
+func (a *Audit) spawn(loop func(stop chan struct{})) {
+	stop := a.stop
+	a.loops.Add(1)
+	go func() {
+		defer a.loops.Done()
+		loop(stop)
+	}()
+}
+
 func (a *Audit) Start() error {
 	if a.IsRun() {
 		return fmt.Errorf("%s is running", a.Name())
 	}
-	a.openFile()
+	env := a.environ()
+	cfg := a.config()
+	a.swapFile(a.openFile(cfg.file))
+	if err := a.dlv.open(cfg.ack, cfg.spool, env.Now()); err != nil {
+		env.Errorf("%s open ack index fail %v", a.Name(), err)
+	}
+
+	if cfg.inhibitFile != "" {
+		if err := a.mem.restore(cfg.inhibitFile); err != nil {
+			env.Errorf("%s restore inhibit state fail %v", a.Name(), err)
+		}
+	}
+
+	a.openStore(cfg)
+	a.serveMetrics(cfg.metrics)
+	atomic.StoreInt32(&a.closing, 0)
+	a.stop = make(chan struct{})
+	a.spawn(a.rollupLoop)
+	a.spawn(a.retryLoop)
+	a.spawn(a.heartbeatLoop)
 	a.V(lua.PTRun, time.Now())
 	return nil
 }
@@ -0,0 +1,72 @@
+package audittest
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	count  int
+	expire time.Time
+}
+
+// Bucket 内存计数存储 过期时间由 Clock 决定
+// Incr 返回累加之前的值 第一次出现的key返回0
+type Bucket struct {
+	mu    sync.Mutex
+	clock *Clock
+	data  map[string]*entry
+}
+
+func NewBucket(clock *Clock) *Bucket {
+	return &Bucket{clock: clock, data: make(map[string]*entry)}
+}
+
+func (b *Bucket) Incr(key string, delta int, ttl int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	e, ok := b.data[key]
+	if !ok || !now.Before(e.expire) {
+		b.data[key] = &entry{count: delta, expire: now.Add(time.Duration(ttl) * time.Second)}
+		return 0, nil
+	}
+
+	prev := e.count
+	e.count += delta
+	return prev, nil
+}
+
+func (b *Bucket) Delete(key string) error {
+	b.mu.Lock()
+	delete(b.data, key)
+	b.mu.Unlock()
+	return nil
+}
+
+// Count 当前计数 过期的key返回0
+func (b *Bucket) Count(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.data[key]
+	if !ok || !b.clock.Now().Before(e.expire) {
+		return 0
+	}
+	return e.count
+}
+
+func (b *Bucket) Keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	var keys []string
+	for k, e := range b.data {
+		if now.Before(e.expire) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,250 @@
+package audittest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// LogRecord 本地collector收到的日志记录 属性统一转换成字符串
+type LogRecord struct {
+	Severity     int
+	SeverityText string
+	Body         string
+	Attrs        map[string]string
+	Resource     map[string]string
+}
+
+// Collector 本地的 OTLP/HTTP 接收端 用来验证 audit.OTLPSink
+type Collector struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	records []LogRecord
+	posts   int
+	status  int
+}
+
+func NewCollector() *Collector {
+	c := &Collector{status: http.StatusOK}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+// Endpoint OTLPSink 使用的地址
+func (c *Collector) Endpoint() string {
+	return c.URL + "/v1/logs"
+}
+
+// Status 之后的请求全部返回code 模拟collector异常
+func (c *Collector) Status(code int) {
+	c.mu.Lock()
+	c.status = code
+	c.mu.Unlock()
+}
+
+func (c *Collector) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	records, err := decodeExport(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status != http.StatusOK {
+		w.WriteHeader(c.status)
+		return
+	}
+	c.posts++
+	c.records = append(c.records, records...)
+}
+
+func (c *Collector) Records() []LogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LogRecord(nil), c.records...)
+}
+
+// Posts 成功接收的请求次数 用来验证批量发送
+func (c *Collector) Posts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.posts
+}
+
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	c.records = nil
+	c.posts = 0
+	c.mu.Unlock()
+}
+
+var errProto = errors.New("invalid protobuf")
+
+type field struct {
+	num  int
+	wire int
+	u    uint64
+	raw  []byte
+}
+
+// fields 解析一层protobuf消息
+func fields(b []byte) ([]field, error) {
+	var out []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errProto
+		}
+		b = b[n:]
+
+		f := field{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case 0:
+			f.u, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errProto
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errProto
+			}
+			f.u = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errProto
+			}
+			f.raw = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 5:
+			if len(b) < 4 {
+				return nil, errProto
+			}
+			f.u = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, errProto
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func anyValue(b []byte) string {
+	fs, _ := fields(b)
+	for _, f := range fs {
+		switch f.num {
+		case 1:
+			return string(f.raw)
+		case 2:
+			return strconv.FormatBool(f.u != 0)
+		case 3:
+			return strconv.FormatInt(int64(f.u), 10)
+		case 4:
+			return strconv.FormatFloat(math.Float64frombits(f.u), 'g', -1, 64)
+		}
+	}
+	return ""
+}
+
+func keyValues(fs []field, num int) map[string]string {
+	m := make(map[string]string)
+	for _, f := range fs {
+		if f.num != num || f.wire != 2 {
+			continue
+		}
+
+		kv, _ := fields(f.raw)
+		var key, val string
+		for _, item := range kv {
+			switch item.num {
+			case 1:
+				key = string(item.raw)
+			case 2:
+				val = anyValue(item.raw)
+			}
+		}
+		m[key] = val
+	}
+	return m
+}
+
+// decodeExport ExportLogsServiceRequest -> ResourceLogs -> ScopeLogs -> LogRecord
+func decodeExport(body []byte) ([]LogRecord, error) {
+	top, err := fields(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []LogRecord
+	for _, rl := range top {
+		if rl.num != 1 {
+			continue
+		}
+
+		rf, err := fields(rl.raw)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := make(map[string]string)
+		for _, f := range rf {
+			if f.num == 1 {
+				res, _ := fields(f.raw)
+				resource = keyValues(res, 1)
+			}
+		}
+
+		for _, sl := range rf {
+			if sl.num != 2 {
+				continue
+			}
+
+			sf, err := fields(sl.raw)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, lr := range sf {
+				if lr.num != 2 {
+					continue
+				}
+
+				lf, err := fields(lr.raw)
+				if err != nil {
+					return nil, err
+				}
+
+				rec := LogRecord{Attrs: keyValues(lf, 6), Resource: resource}
+				for _, f := range lf {
+					switch f.num {
+					case 2:
+						rec.Severity = int(f.u)
+					case 3:
+						rec.SeverityText = string(f.raw)
+					case 5:
+						rec.Body = anyValue(f.raw)
+					}
+				}
+				out = append(out, rec)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,141 @@
+package audittest
+
+import (
+	"fmt"
+	audit "github.com/vela-security/vela-audit"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ID   = "audittest-node"
+	Inet = "127.0.0.1"
+)
+
+// Env 实现 audit.Env 的内存环境 所有依赖都可以在测试中观察
+type Env struct {
+	Clock  *Clock
+	Tunnel *Tunnel
+
+	mu      sync.Mutex
+	id      string
+	inet    string
+	debug   bool
+	incr    bool
+	region  map[string]string
+	buckets map[string]*Bucket
+	errs    []string
+	debugs  []string
+}
+
+type Option func(*Env)
+
+func WithID(id string) Option {
+	return func(e *Env) { e.id = id }
+}
+
+func WithInet(inet string) Option {
+	return func(e *Env) { e.inet = inet }
+}
+
+func WithTime(now time.Time) Option {
+	return func(e *Env) { e.Clock.Set(now) }
+}
+
+// WithDebug debug模式下 audit 不会做告警限速
+func WithDebug(v bool) Option {
+	return func(e *Env) { e.debug = v }
+}
+
+// WithIncrOnly Bucket 只支持 Incr 模拟不能删除和读取计数的存储
+func WithIncrOnly() Option {
+	return func(e *Env) { e.incr = true }
+}
+
+func WithRegion(addr, region string) Option {
+	return func(e *Env) { e.region[addr] = region }
+}
+
+func NewEnv(opts ...Option) *Env {
+	e := &Env{
+		Clock:   NewClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Tunnel:  &Tunnel{},
+		id:      ID,
+		inet:    Inet,
+		region:  make(map[string]string),
+		buckets: make(map[string]*Bucket),
+	}
+
+	for _, fn := range opts {
+		fn(e)
+	}
+	return e
+}
+
+func (e *Env) ID() string        { return e.id }
+func (e *Env) LocalAddr() string { return e.inet }
+func (e *Env) IsDebug() bool     { return e.debug }
+func (e *Env) Now() time.Time    { return e.Clock.Now() }
+
+func (e *Env) Region(addr string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	v, ok := e.region[addr]
+	if !ok {
+		return "", fmt.Errorf("region %s not found", addr)
+	}
+	return v, nil
+}
+
+// Bucket 同样的名称返回同一个存储
+func (e *Env) Bucket(bkt ...string) audit.Bucket {
+	b := e.FakeBucket(bkt...)
+	if e.incr {
+		return audit.BucketFunc(b.Incr)
+	}
+	return b
+}
+
+func (e *Env) FakeBucket(bkt ...string) *Bucket {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := strings.Join(bkt, "/")
+	b, ok := e.buckets[name]
+	if !ok {
+		b = NewBucket(e.Clock)
+		e.buckets[name] = b
+	}
+	return b
+}
+
+func (e *Env) TnlSend(data []byte) error {
+	return e.Tunnel.send(data)
+}
+
+func (e *Env) Errorf(format string, v ...interface{}) {
+	e.mu.Lock()
+	e.errs = append(e.errs, fmt.Sprintf(format, v...))
+	e.mu.Unlock()
+}
+
+func (e *Env) Debugf(format string, v ...interface{}) {
+	e.mu.Lock()
+	e.debugs = append(e.debugs, fmt.Sprintf(format, v...))
+	e.mu.Unlock()
+}
+
+// Errors 通过 Errorf 输出的日志
+func (e *Env) Errors() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.errs...)
+}
+
+func (e *Env) Debugs() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.debugs...)
+}
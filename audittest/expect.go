@@ -0,0 +1,76 @@
+package audittest
+
+import (
+	audit "github.com/vela-security/vela-audit"
+	"testing"
+)
+
+// ExpectEvent 至少存在一条typeof类型的事件 返回最后一条
+func (r *Recorder) ExpectEvent(t testing.TB, typeof string) *audit.Event {
+	t.Helper()
+
+	evs := r.Typeof(typeof)
+	if len(evs) == 0 {
+		t.Fatalf("expect %s event , got none", typeof)
+		return nil
+	}
+	return evs[len(evs)-1]
+}
+
+// ExpectAlert 至少存在一条没有被限速的typeof类型的告警 返回最后一条
+func (r *Recorder) ExpectAlert(t testing.TB, typeof string) *audit.Event {
+	t.Helper()
+
+	evs := r.Typeof(typeof)
+	for i := len(evs) - 1; i >= 0; i-- {
+		if evs[i].IsAlert() {
+			return evs[i]
+		}
+	}
+
+	t.Fatalf("expect %s alert , got %d event without alert", typeof, len(evs))
+	return nil
+}
+
+// ExpectNoAlert typeof类型的事件都没有告警 用来验证限速
+func (r *Recorder) ExpectNoAlert(t testing.TB, typeof string) {
+	t.Helper()
+
+	for _, ev := range r.Typeof(typeof) {
+		if ev.IsAlert() {
+			t.Fatalf("expect no %s alert , got %s", typeof, ev.String())
+		}
+	}
+}
+
+func (r *Recorder) ExpectCount(t testing.TB, typeof string, n int) {
+	t.Helper()
+
+	if got := len(r.Typeof(typeof)); got != n {
+		t.Fatalf("expect %d %s event , got %d", n, typeof, got)
+	}
+}
+
+// ExpectField 事件字段等于val 字段名同 Event.Field
+func ExpectField(t testing.TB, ev *audit.Event, key string, val string) {
+	t.Helper()
+
+	if got := ev.Field(key); got != val {
+		t.Fatalf("expect %s = %q , got %q", key, val, got)
+	}
+}
+
+// ExpectUpload 通过 TnlSend 上传过typeof类型的事件
+func (t *Tunnel) ExpectUpload(tb testing.TB, typeof string) map[string]interface{} {
+	tb.Helper()
+
+	evs := t.Decode()
+	for i := len(evs) - 1; i >= 0; i-- {
+		if evs[i]["typeof"] == typeof {
+			return evs[i]
+		}
+	}
+
+	tb.Fatalf("expect %s upload , got %d upload without it", typeof, len(evs))
+	return nil
+}
@@ -0,0 +1,69 @@
+package audittest
+
+import (
+	audit "github.com/vela-security/vela-audit"
+	"sync"
+)
+
+// Recorder 记录所有输出事件的 audit.Sink
+type Recorder struct {
+	mu     sync.Mutex
+	events []*audit.Event
+	closed bool
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Write(ev *audit.Event) error {
+	r.mu.Lock()
+	r.events = append(r.events, ev)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Recorder) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (r *Recorder) Events() []*audit.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*audit.Event(nil), r.events...)
+}
+
+// Typeof 指定类型的事件
+func (r *Recorder) Typeof(typeof string) []*audit.Event {
+	var out []*audit.Event
+	for _, ev := range r.Events() {
+		if ev.Typeof() == typeof {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.events = nil
+	r.mu.Unlock()
+}
+
+// New 创建使用内存环境的审计对象 并挂载 Recorder
+func New(opts ...Option) (*audit.Audit, *Env, *Recorder) {
+	env := NewEnv(opts...)
+	rec := NewRecorder()
+	adt := audit.NewWithEnv(env)
+	adt.AddSink(rec)
+	return adt, env, rec
+}
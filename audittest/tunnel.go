@@ -0,0 +1,59 @@
+package audittest
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Tunnel 记录 TnlSend 的调用 可以通过 Fail 模拟发送失败
+type Tunnel struct {
+	mu   sync.Mutex
+	sent [][]byte
+	err  error
+}
+
+func (t *Tunnel) send(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+
+	raw := make([]byte, len(data))
+	copy(raw, data)
+	t.sent = append(t.sent, raw)
+	return nil
+}
+
+// Fail 之后的发送全部返回err 传入nil恢复
+func (t *Tunnel) Fail(err error) {
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+}
+
+func (t *Tunnel) Sent() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][]byte(nil), t.sent...)
+}
+
+// Decode 按json解析已发送的事件
+func (t *Tunnel) Decode() []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, raw := range t.Sent() {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &m); err != nil {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (t *Tunnel) Reset() {
+	t.mu.Lock()
+	t.sent = nil
+	t.mu.Unlock()
+}
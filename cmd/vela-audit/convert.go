@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+// columns csv 和 logfmt 输出的字段顺序 附加属性按照 attr.key 追加在后面
+var columns = []string{
+	"time", "event_id", "trace_id", "parent_id", "id", "inet", "level", "severity", "typeof", "subject",
+	"from", "user", "auth", "remote_addr", "remote_port", "region", "alert", "msg", "msg_ref", "err", "error.type", "error.cause", "count",
+}
+
+// lang level 列输出的语言 -lang en 输出 info , low , high , serious , critical
+var lang = audit.LangZH
+
+func field(ev *audit.Event, key string) string {
+	switch key {
+	case "time":
+		return ev.Timestamp().Format("2006-01-02T15:04:05.000Z07:00")
+	case "level":
+		return ev.Severity().Label(lang)
+	}
+	return ev.Field(key)
+}
+
+func attrKeys(ev *audit.Event) []string {
+	attrs := ev.Attrs()
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func convertCmd(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	expr := filterFlag(fs)
+	to := fs.String("to", "logfmt", "output format: cef , logfmt , csv")
+	fs.StringVar(&lang, "lang", audit.LangZH, "level label language: zh , en")
+	fs.Parse(args)
+
+	f, err := compile(*expr)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	switch *to {
+	case "cef":
+		return events(fs.Args(), f, func(ev *audit.Event, _ []byte) error {
+			_, err := w.WriteString(cef(ev) + "\n")
+			return err
+		})
+
+	case "logfmt":
+		return events(fs.Args(), f, func(ev *audit.Event, _ []byte) error {
+			_, err := w.WriteString(logfmt(ev) + "\n")
+			return err
+		})
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+		cw.Write(append(columns[:len(columns):len(columns)], "attrs"))
+		return events(fs.Args(), f, func(ev *audit.Event, _ []byte) error {
+			row := make([]string, 0, len(columns)+1)
+			for _, c := range columns {
+				row = append(row, field(ev, c))
+			}
+
+			//csv 的列是固定的 附加属性合并成一列logfmt
+			var attrs []string
+			for _, k := range attrKeys(ev) {
+				attrs = append(attrs, logfmtPair(k, ev.Field("attr."+k)))
+			}
+			row = append(row, strings.Join(attrs, " "))
+			return cw.Write(row)
+		})
+
+	default:
+		return fmt.Errorf("unknown format %s , must be cef , logfmt or csv", *to)
+	}
+}
+
+var logfmtKey = strings.NewReplacer(" ", "_", "=", "_", "\"", "_")
+
+func logfmtPair(key, val string) string {
+	key = logfmtKey.Replace(key)
+	if val == "" || strings.ContainsAny(val, " =\"\t\r\n") {
+		return key + "=" + strconv.Quote(val)
+	}
+	return key + "=" + val
+}
+
+func logfmt(ev *audit.Event) string {
+	pairs := make([]string, 0, len(columns))
+	for _, c := range columns {
+		v := field(ev, c)
+		if v == "" {
+			continue
+		}
+		pairs = append(pairs, logfmtPair(c, v))
+	}
+
+	for _, k := range attrKeys(ev) {
+		pairs = append(pairs, logfmtPair("attr."+k, ev.Field("attr."+k)))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// cefSeverity 等级对应 CEF 的 0-10
+func cefSeverity(s audit.Severity) int {
+	switch s {
+	case audit.SeverityCritical:
+		return 10
+	case audit.SeveritySerious:
+		return 8
+	case audit.SeverityHigh:
+		return 7
+	case audit.SeverityLow:
+		return 5
+	case audit.SeverityInfo:
+		return 3
+	default:
+		return 0
+	}
+}
+
+var (
+	cefHeader    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtension = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// cef CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func cef(ev *audit.Event) string {
+	var ext []string
+	add := func(key, val string) {
+		if val != "" {
+			ext = append(ext, key+"="+cefExtension.Replace(val))
+		}
+	}
+
+	add("rt", strconv.FormatInt(ev.Timestamp().UnixMilli(), 10))
+	add("externalId", ev.Field("event_id"))
+	add("deviceExternalId", ev.Field("id"))
+	add("dvc", ev.Field("inet"))
+	add("src", ev.Field("remote_addr"))
+	if port := ev.Field("remote_port"); port != "0" {
+		add("spt", port)
+	}
+	add("suser", ev.Field("user"))
+	add("sproc", ev.Field("from"))
+	add("msg", ev.Field("msg"))
+	add("reason", ev.Field("err"))
+	if auth := ev.Field("auth"); auth != "" {
+		add("cs1Label", "auth")
+		add("cs1", auth)
+	}
+	if region := ev.Field("region"); region != "" {
+		add("cs2Label", "region")
+		add("cs2", region)
+	}
+	for _, k := range attrKeys(ev) {
+		add("vela"+logfmtKey.Replace(k), ev.Field("attr."+k))
+	}
+
+	return fmt.Sprintf("CEF:0|vela|audit|1.0|%s|%s|%d|%s",
+		cefHeader.Replace(ev.Typeof()),
+		cefHeader.Replace(ev.Field("subject")),
+		cefSeverity(ev.Severity()),
+		strings.Join(ext, " "))
+}
@@ -0,0 +1,257 @@
+// vela-audit 离线查看审计日志 支持从主机上拷贝下来的 vela.audit.log 以及轮转之后的 .gz 文件
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+const usage = `usage: vela-audit <command> [flags] [file ...]
+
+commands:
+  tail     输出最后几条事件 -f 持续跟踪
+  filter   按照过滤表达式输出原始事件
+  pretty   按行格式化输出
+  convert  转换成 cef , logfmt , csv
+  summary  统计 typeof , user , remote_addr 的排行
+  verify   校验日志文件 事件ID 去重key 时间顺序
+  attach   输出被截断的消息原文 vela-audit attach -dir vela.audit.attach <msg_ref>
+
+没有指定文件时从标准输入读取 只支持 format = vela 输出的日志
+`
+
+type command struct {
+	name string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"tail", tailCmd},
+	{"filter", filterCmd},
+	{"pretty", prettyCmd},
+	{"convert", convertCmd},
+	{"summary", summaryCmd},
+	{"verify", verifyCmd},
+	{"attach", attachCmd},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "vela-audit %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", name, usage)
+	os.Exit(2)
+}
+
+// filterFlag 所有命令共用的 -e 过滤表达式
+func filterFlag(fs *flag.FlagSet) *string {
+	return fs.String("e", "", "filter expression , e.g. \"typeof = login && level >= 重要\"")
+}
+
+func compile(expr string) (audit.Filter, error) {
+	if expr == "" {
+		return audit.FilterFunc(func(*audit.Event) bool { return true }), nil
+	}
+	return audit.NewCondition(expr)
+}
+
+func open(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return fd, nil
+	}
+
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, fd}, nil
+}
+
+// scan 逐行读取所有文件 fn 返回错误时停止
+func scan(paths []string, fn func(path string, line int, raw []byte) error) error {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	for _, path := range paths {
+		r, err := open(path)
+		if err != nil {
+			return err
+		}
+
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		line := 0
+		for sc.Scan() {
+			line++
+			if len(sc.Bytes()) == 0 {
+				continue
+			}
+
+			if err = fn(path, line, sc.Bytes()); err != nil {
+				r.Close()
+				return err
+			}
+		}
+		r.Close()
+
+		if err = sc.Err(); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// events 解析失败的行输出到标准错误并跳过
+func events(paths []string, f audit.Filter, fn func(ev *audit.Event, raw []byte) error) error {
+	return scan(paths, func(path string, line int, raw []byte) error {
+		ev, err := audit.DecodeEvent(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, line, err)
+			return nil
+		}
+
+		if !f.Match(ev) {
+			return nil
+		}
+		return fn(ev, raw)
+	})
+}
+
+func filterCmd(args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	expr := filterFlag(fs)
+	fs.Parse(args)
+
+	f, err := compile(*expr)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	return events(fs.Args(), f, func(_ *audit.Event, raw []byte) error {
+		w.Write(raw)
+		return w.WriteByte('\n')
+	})
+}
+
+func prettyCmd(args []string) error {
+	fs := flag.NewFlagSet("pretty", flag.ExitOnError)
+	expr := filterFlag(fs)
+	dir := fs.String("attach", "", "attachment dir , print full msg instead of truncated one")
+	fs.StringVar(&lang, "lang", audit.LangZH, "level label language: zh , en")
+	fs.Parse(args)
+
+	f, err := compile(*expr)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	return events(fs.Args(), f, func(ev *audit.Event, _ []byte) error {
+		if ref := ev.MsgRef(); ref != "" && *dir != "" {
+			if data, err := audit.ReadAttachment(*dir, ref); err == nil {
+				ev.Msg("%s", data)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", ev.EventID(), err)
+			}
+		}
+
+		_, err := w.WriteString(pretty(ev) + "\n")
+		return err
+	})
+}
+
+func attachCmd(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	dir := fs.String("dir", "vela.audit.attach", "attachment dir")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("missing msg_ref")
+	}
+
+	for _, ref := range fs.Args() {
+		data, err := audit.ReadAttachment(*dir, ref)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+	}
+	return nil
+}
+
+var oneLine = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// pretty 时间 等级 类型 主题 用户@远端 消息 换行转义之后保持一条事件一行
+func pretty(ev *audit.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %-10s %s", ev.Timestamp().Format("2006-01-02 15:04:05"),
+		ev.Severity().Label(lang), ev.Typeof(), ev.Field("subject"))
+
+	if user := ev.Field("user"); user != "" {
+		fmt.Fprintf(&b, "  user=%s", user)
+	}
+
+	if addr := ev.Field("remote_addr"); addr != "" {
+		fmt.Fprintf(&b, "  remote=%s:%s", addr, ev.Field("remote_port"))
+	}
+
+	if from := ev.Field("from"); from != "" {
+		fmt.Fprintf(&b, "  from=%s", from)
+	}
+
+	if msg := ev.Field("msg"); msg != "" {
+		fmt.Fprintf(&b, "  %s", oneLine.Replace(msg))
+	}
+
+	if ref := ev.MsgRef(); ref != "" {
+		fmt.Fprintf(&b, "  msg_ref=%s", ref)
+	}
+
+	if e := ev.Field("err"); e != "" {
+		fmt.Fprintf(&b, "  error=%s", oneLine.Replace(e))
+	}
+
+	if ev.IsAlert() {
+		b.WriteString("  [alert]")
+	}
+	return b.String()
+}
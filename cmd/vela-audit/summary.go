@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+type counter map[string]int
+
+type rank struct {
+	key   string
+	count int
+}
+
+func (c counter) top(n int) []rank {
+	out := make([]rank, 0, len(c))
+	for k, v := range c {
+		out = append(out, rank{k, v})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].count != out[j].count {
+			return out[i].count > out[j].count
+		}
+		return out[i].key < out[j].key
+	})
+
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func summaryCmd(args []string) error {
+	fs := flag.NewFlagSet("summary", flag.ExitOnError)
+	expr := filterFlag(fs)
+	n := fs.Int("top", 10, "number of rows for each ranking")
+	fs.Parse(args)
+
+	f, err := compile(*expr)
+	if err != nil {
+		return err
+	}
+
+	groups := []struct {
+		title string
+		field string
+		data  counter
+	}{
+		{"typeof", "typeof", counter{}},
+		{"level", "level", counter{}},
+		{"user", "user", counter{}},
+		{"remote_addr", "remote_addr", counter{}},
+		{"from", "from", counter{}},
+	}
+
+	var total, alert int
+	var first, last time.Time
+	err = events(fs.Args(), f, func(ev *audit.Event, _ []byte) error {
+		total++
+		if ev.IsAlert() {
+			alert++
+		}
+
+		tm := ev.Timestamp()
+		if first.IsZero() || tm.Before(first) {
+			first = tm
+		}
+		if tm.After(last) {
+			last = tm
+		}
+
+		for _, g := range groups {
+			if v := ev.Field(g.field); v != "" {
+				g.data[v]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "events\t%d\n", total)
+	fmt.Fprintf(w, "alert\t%d\n", alert)
+	if total > 0 {
+		fmt.Fprintf(w, "first\t%s\n", first.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "last\t%s\n", last.Format("2006-01-02 15:04:05"))
+	}
+
+	for _, g := range groups {
+		if len(g.data) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s\tcount\n", g.title)
+		for _, r := range g.data.top(*n) {
+			fmt.Fprintf(w, "%s\t%d\n", r.key, r.count)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+const tailPoll = 500 * time.Millisecond
+
+func tailCmd(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	expr := filterFlag(fs)
+	n := fs.Int("n", 10, "number of events")
+	follow := fs.Bool("f", false, "follow the file , reopen after rotation")
+	raw := fs.Bool("raw", false, "print raw json instead of pretty line")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("tail need exactly one file")
+	}
+
+	f, err := compile(*expr)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	emit := func(line []byte) {
+		ev, err := audit.DecodeEvent(line)
+		if err != nil || !f.Match(ev) {
+			return
+		}
+
+		if *raw {
+			w.Write(line)
+			w.WriteByte('\n')
+			return
+		}
+		w.WriteString(pretty(ev) + "\n")
+	}
+
+	path := fs.Arg(0)
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { fd.Close() }()
+
+	lines, offset, err := last(fd, *n, f)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		emit(line)
+	}
+	w.Flush()
+
+	if !*follow {
+		return nil
+	}
+
+	var partial []byte
+	for {
+		time.Sleep(tailPoll)
+
+		//文件被轮转或者截断 从头开始读新文件
+		if st, err := os.Stat(path); err == nil {
+			cur, _ := fd.Stat()
+			if !os.SameFile(st, cur) || st.Size() < offset {
+				if nfd, err := os.Open(path); err == nil {
+					fd.Close()
+					fd, offset, partial = nfd, 0, nil
+				}
+			}
+		}
+
+		data, err := io.ReadAll(io.NewSectionReader(fd, offset, 1<<62))
+		if err != nil {
+			return err
+		}
+		offset += int64(len(data))
+
+		partial = append(partial, data...)
+		for {
+			idx := bytes.IndexByte(partial, '\n')
+			if idx < 0 {
+				break
+			}
+			if idx > 0 {
+				emit(partial[:idx])
+			}
+			partial = partial[idx+1:]
+		}
+		w.Flush()
+	}
+}
+
+// last 从文件末尾向前扫描一次 每行只解析一次 直到找到n条匹配的事件
+// 末尾没有换行的半行不输出 返回最后一个换行之后的偏移 follow 时等这一行写完整再读
+func last(fd *os.File, n int, f audit.Filter) ([][]byte, int64, error) {
+	st, err := fd.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	match := func(line []byte) bool {
+		if len(line) == 0 {
+			return false
+		}
+		ev, err := audit.DecodeEvent(line)
+		return err == nil && f.Match(ev)
+	}
+
+	const chunk = 64 * 1024
+	var out [][]byte
+	var carry []byte
+	end := int64(-1)
+	pos := st.Size()
+	for pos > 0 && (end < 0 || len(out) < n) {
+		step := int64(chunk)
+		if pos < step {
+			step = pos
+		}
+		pos -= step
+
+		buf := make([]byte, step, step+int64(len(carry)))
+		if _, err := fd.ReadAt(buf, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+
+		//carry 是后一块中第一个换行之前的部分 拼起来才是完整的一行
+		data := append(buf, carry...)
+		for end < 0 || len(out) < n {
+			idx := bytes.LastIndexByte(data, '\n')
+			if idx < 0 {
+				break
+			}
+
+			line := data[idx+1:]
+			data = data[:idx]
+			if end < 0 {
+				end = pos + int64(idx) + 1
+				continue
+			}
+
+			if match(line) {
+				out = append(out, line)
+			}
+		}
+		carry = data
+	}
+
+	//文件的第一行前面没有换行
+	if pos == 0 && end >= 0 && len(out) < n && match(carry) {
+		out = append(out, carry)
+	}
+
+	if end < 0 {
+		end = 0
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, end, nil
+}
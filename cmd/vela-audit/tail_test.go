@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestLast(t *testing.T) {
+	var lines []string
+	for i := 0; i < 3000; i++ {
+		typeof := "a"
+		if i%3 == 0 {
+			typeof = "b"
+		}
+		lines = append(lines, string(audit.NewEvent(typeof).Msg("%d %s", i, strings.Repeat("x", 100)).Byte()))
+	}
+
+	fd, err := os.Open(writeLog(t, lines...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	f, _ := compile("typeof = b")
+	out, _, err := last(fd, 5, f)
+	if err != nil || len(out) != 5 {
+		t.Fatalf("expect 5 lines , got %d %v", len(out), err)
+	}
+
+	for i, line := range out {
+		ev, _ := audit.DecodeEvent(line)
+		want := strconv.Itoa(2985 + 3*i)
+		if !strings.HasPrefix(ev.Field("msg"), want+" ") {
+			t.Fatalf("expect msg %s , got %s", want, ev.Field("msg")[:5])
+		}
+	}
+
+	//匹配的不足n条时 一直读到文件开头 包括第一行
+	out, _, _ = last(fd, 5000, f)
+	if len(out) != 1000 {
+		t.Fatalf("expect 1000 lines , got %d", len(out))
+	}
+	if ev, _ := audit.DecodeEvent(out[0]); !strings.HasPrefix(ev.Field("msg"), "0 ") {
+		t.Fatalf("expect first line , got %s", out[0])
+	}
+}
+
+// 末尾还没有写完的半行不输出 返回的偏移停在最后一个换行之后
+func TestLastPartialLine(t *testing.T) {
+	full := string(audit.NewEvent("login").Msg("done").Byte())
+	path := writeLog(t, full)
+
+	fd, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	fd.WriteString(`{"typeof":"login","msg":"half`)
+
+	f, _ := compile("")
+	out, offset, err := last(fd, 10, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || string(out[0]) != full {
+		t.Fatalf("expect only the complete line , got %q", out)
+	}
+	if offset != int64(len(full)+1) {
+		t.Fatalf("expect offset %d , got %d", len(full)+1, offset)
+	}
+
+	_, offset, _ = last(fd, 0, f)
+	if offset != int64(len(full)+1) {
+		t.Fatalf("expect offset %d with n = 0 , got %d", len(full)+1, offset)
+	}
+}
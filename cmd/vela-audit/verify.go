@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+// report 单个文件的校验结果 backward 只是提示 聚合事件输出时间晚于事件时间属于正常情况
+// noID 是加入 event_id 之前写入的旧日志 只统计不算错误
+type report struct {
+	path      string
+	lines     int
+	events    int
+	invalid   int
+	noID      int
+	badID     int
+	badDedup  int
+	duplicate int
+	backward  int
+}
+
+func (r *report) failed() int {
+	return r.invalid + r.badID + r.badDedup + r.duplicate
+}
+
+type dedupHead struct {
+	DedupKey string `json:"dedup_key"`
+}
+
+func verifyCmd(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "print every problem line")
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	seen := make(map[string]string)
+	var reports []*report
+	for _, path := range paths {
+		r := &report{path: path}
+		reports = append(reports, r)
+
+		problem := func(line int, format string, v ...interface{}) {
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, line, fmt.Sprintf(format, v...))
+			}
+		}
+
+		var prev *audit.Event
+		err := scan([]string{path}, func(_ string, line int, raw []byte) error {
+			r.lines++
+			ev, err := audit.DecodeEvent(raw)
+			if err != nil {
+				r.invalid++
+				problem(line, "invalid event %v", err)
+				return nil
+			}
+			r.events++
+
+			id := ev.EventID()
+			if id == "" {
+				r.noID++
+			} else if _, ok := audit.EventIDTime(id); !ok {
+				r.badID++
+				problem(line, "invalid event_id %q", id)
+			} else if where, ok := seen[id]; ok {
+				r.duplicate++
+				problem(line, "duplicate event_id %s first seen at %s", id, where)
+			} else {
+				seen[id] = fmt.Sprintf("%s:%d", path, line)
+			}
+
+			var head dedupHead
+			json.Unmarshal(raw, &head)
+			if head.DedupKey != "" && head.DedupKey != ev.DedupKey() {
+				r.badDedup++
+				problem(line, "dedup_key %s not match %s", head.DedupKey, ev.DedupKey())
+			}
+
+			if prev != nil && ev.Timestamp().Before(prev.Timestamp()) {
+				r.backward++
+			}
+			prev = ev
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "file\tlines\tevents\tinvalid\tno_id\tbad_id\tbad_dedup\tduplicate\ttime_backward")
+
+	failed := 0
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", r.path, r.lines, r.events,
+			r.invalid, r.noID, r.badID, r.badDedup, r.duplicate, r.backward)
+		failed += r.failed()
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d problem lines found", failed)
+	}
+	return nil
+}
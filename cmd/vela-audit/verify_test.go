@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func writeLog(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vela.audit.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	ev := string(audit.NewEvent("login").Msg("ok").Byte())
+	legacy := `{"time":"2021-01-01 00:00:00","typeof":"login","msg":"old","level":"普通"}`
+
+	cases := []struct {
+		name  string
+		lines []string
+		fail  bool
+	}{
+		{"valid", []string{ev}, false},
+		{"legacy without event_id", []string{legacy, legacy}, false},
+		{"legacy mixed with new", []string{legacy, ev}, false},
+		{"bad event_id", []string{`{"event_id":"xyz","typeof":"login"}`}, true},
+		{"duplicate", []string{ev, ev}, true},
+		{"invalid json", []string{"{"}, true},
+	}
+
+	for _, c := range cases {
+		err := verifyCmd([]string{writeLog(t, c.lines...)})
+		if (err != nil) != c.fail {
+			t.Fatalf("%s expect fail %v , got %v", c.name, c.fail, err)
+		}
+	}
+}
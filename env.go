@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	opcode "github.com/vela-security/vela-opcode"
+	"github.com/vela-security/vela-public/assert"
+	"github.com/vela-security/vela-public/lua"
+	"log"
+	"time"
+)
+
+// Env audit 依赖的运行环境 默认由 WithEnv 注入的 assert.Environment 提供
+// 单元测试或者独立的 Audit 实例可以通过 NewWithEnv 替换
+type Env interface {
+	ID() string
+	LocalAddr() string
+	Region(addr string) (string, error)
+	Bucket(bkt ...string) Bucket
+	TnlSend(data []byte) error
+	IsDebug() bool
+	Now() time.Time
+	Errorf(format string, v ...interface{})
+	Debugf(format string, v ...interface{})
+}
+
+// Bucket 告警限速使用的计数存储
+type Bucket interface {
+	Incr(key string, delta int, ttl int) (int, error)
+}
+
+// bucketDeleter 支持删除key的存储 adt.release 使用
+type bucketDeleter interface {
+	Delete(key string) error
+}
+
+// bucketCounter 支持读取计数的存储 Explain 使用 不会累加计数
+type bucketCounter interface {
+	Count(key string) int
+}
+
+type BucketFunc func(key string, delta int, ttl int) (int, error)
+
+func (fn BucketFunc) Incr(key string, delta int, ttl int) (int, error) {
+	return fn(key, delta, ttl)
+}
+
+var defaultEnv Env = nopEnv{}
+
+// agentEnv 适配 assert.Environment
+type agentEnv struct {
+	env assert.Environment
+}
+
+func (e agentEnv) ID() string        { return e.env.ID() }
+func (e agentEnv) LocalAddr() string { return e.env.LocalAddr() }
+func (e agentEnv) IsDebug() bool     { return e.env.IsDebug() }
+func (e agentEnv) Now() time.Time    { return time.Now() }
+
+func (e agentEnv) Region(addr string) (string, error) {
+	ip, err := e.env.Region(addr)
+	if err != nil {
+		return "", err
+	}
+	return lua.B2S(ip.Byte()), nil
+}
+
+func (e agentEnv) Bucket(bkt ...string) Bucket {
+	db := e.env.Bucket(bkt...)
+	b := agentBucket(func(key string, delta int, ttl int) (int, error) {
+		count, err := db.Incr(key, delta, ttl)
+		return int(count), err
+	})
+
+	//只有底层存储支持删除时才暴露 Delete 调用方按照接口判断能力
+	if d, ok := interface{}(db).(bucketDeleter); ok {
+		return &agentDelBucket{agentBucket: b, del: d.Delete}
+	}
+	return b
+}
+
+type agentBucket BucketFunc
+
+func (b agentBucket) Incr(key string, delta int, ttl int) (int, error) {
+	return b(key, delta, ttl)
+}
+
+type agentDelBucket struct {
+	agentBucket
+	del func(string) error
+}
+
+func (b *agentDelBucket) Delete(key string) error {
+	return b.del(key)
+}
+
+func (e agentEnv) TnlSend(data []byte) error {
+	return e.env.TnlSend(opcode.OpEvent, json.RawMessage(data))
+}
+
+func (e agentEnv) Errorf(format string, v ...interface{}) {
+	e.env.Errorf(format, v...)
+}
+
+func (e agentEnv) Debugf(format string, v ...interface{}) {
+	e.env.Debugf(format, v...)
+}
+
+// nopEnv 没有注入环境时使用 错误直接输出到标准日志
+type nopEnv struct{}
+
+var errNoEnv = errors.New("audit environment not found")
+
+func (nopEnv) ID() string                        { return "" }
+func (nopEnv) LocalAddr() string                 { return "" }
+func (nopEnv) IsDebug() bool                     { return false }
+func (nopEnv) Now() time.Time                    { return time.Now() }
+func (nopEnv) Region(string) (string, error)     { return "", errNoEnv }
+func (nopEnv) TnlSend([]byte) error              { return errNoEnv }
+func (nopEnv) Debugf(string, ...interface{})     {}
+func (nopEnv) Errorf(f string, v ...interface{}) { log.Printf(f, v...) }
+
+func (nopEnv) Bucket(...string) Bucket {
+	return BucketFunc(func(string, int, int) (int, error) {
+		return 0, errNoEnv
+	})
+}
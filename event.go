@@ -5,30 +5,65 @@ import (
 )
 
 type Event struct {
-	time    time.Time //time
-	id      string
-	inet    string
-	subject string //subject
-	rAddr   string //remote addr
-	rPort   int    //remote port
-	from    string //Event from proc name
-	typeof  string //type
-	user    string //user
-	auth    string //auth
-	msg     string //info
-	err     error  //error
-	region  string
-	alert   bool
-	upload  bool
-	level   string
+	adt      *Audit
+	uid      string    //event id
+	trace    string    //trace id
+	parent   string    //parent event id
+	time     time.Time //time
+	id       string
+	inet     string
+	subject  string //subject
+	rAddr    string //remote addr
+	rPort    int    //remote port
+	from     string //Event from proc name
+	typeof   string //type
+	user     string //user
+	auth     string //auth
+	msg      string //info
+	ref      string //msg attachment sha256
+	size     int    //msg size before truncate
+	err      error  //error
+	stack    string //error stack
+	region   string
+	alert    bool
+	upload   bool
+	level    Severity
+	attrs    []attr
+	roll     *rollupInfo
+	rolled   bool
+	held     bool    //聚合窗口结束时输出 合并时已经统计过耗时
+	internal bool    //审计自身的心跳和停止事件 不计入统计
+	rate     float64 //sample rate
+}
+
+type attr struct {
+	key string
+	val string
+}
+
+// snapshot 拷贝事件 交给其他协程的事件不再和 handle 共享 attrs 和 roll
+func (ev *Event) snapshot() *Event {
+	c := *ev
+	c.attrs = append([]attr(nil), ev.attrs...)
+	if ev.roll != nil {
+		roll := *ev.roll
+		roll.samples = make([]rollupSample, len(ev.roll.samples))
+		for i, s := range ev.roll.samples {
+			roll.samples[i] = rollupSample{field: s.field, values: append([]string(nil), s.values...)}
+		}
+		c.roll = &roll
+	}
+	return &c
 }
 
 func NewEvent(typeof string, opts ...func(*Event)) *Event {
+	now := defaultEnv.Now()
 	ev := &Event{
-		id:     xEnv.ID(),
-		inet:   xEnv.LocalAddr(),
-		time:   time.Now(),
-		level:  NOTICE,
+		uid:    eventID.next(now),
+		id:     defaultEnv.ID(),
+		inet:   defaultEnv.LocalAddr(),
+		time:   now,
+		level:  SeverityInfo,
 		typeof: typeof,
 	}
 
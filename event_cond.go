@@ -0,0 +1,255 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/vela-security/vela-public/lua"
+	"strconv"
+	"strings"
+)
+
+// newCondition 事件过滤表达式 || 优先级低于 &&
+//
+//	level >= 重要 && typeof = login* || from = sshd
+//	msg = "a >= b && c"
+//
+// = 和 != 使用 grep 通配 > >= < <= 按照数值比较 level 按照等级数值比较 可以写成 重要 , high , 3
+// 每个条件依次是 字段名 , 操作符 , 值 值中包含操作符 && || 或者首尾空格时使用引号
+func newCondition(expr string) (match, error) {
+	p := &condParser{s: expr}
+	p.space()
+	if p.eof() {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	var ors, all []match
+	for {
+		m, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+
+		p.space()
+		if p.eof() {
+			ors = append(ors, matchAll(all))
+			break
+		}
+
+		switch {
+		case p.take("&&"):
+		case p.take("||"):
+			ors = append(ors, matchAll(all))
+			all = nil
+		default:
+			return nil, fmt.Errorf("invalid condition %s , unexpected %q at %d", expr, p.s[p.i:], p.i)
+		}
+	}
+
+	if len(ors) == 1 {
+		return ors[0], nil
+	}
+
+	return func(ev *Event) bool {
+		for _, m := range ors {
+			if m(ev) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func matchAll(all []match) match {
+	if len(all) == 1 {
+		return all[0]
+	}
+
+	return func(ev *Event) bool {
+		for _, m := range all {
+			if !m(ev) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+var clauseOp = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// condParser 按字符扫描表达式 操作符只在字段名之后识别 值中的操作符不会影响解析
+type condParser struct {
+	s string
+	i int
+}
+
+func (p *condParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *condParser) space() {
+	for !p.eof() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *condParser) take(tok string) bool {
+	if strings.HasPrefix(p.s[p.i:], tok) {
+		p.i += len(tok)
+		return true
+	}
+	return false
+}
+
+// isKeyChar 字段名 typeof , attr.port , error.type , remote_addr
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+func (p *condParser) clause() (match, error) {
+	p.space()
+	start := p.i
+	for !p.eof() && isKeyChar(p.s[p.i]) {
+		p.i++
+	}
+
+	key := p.s[start:p.i]
+	if key == "" {
+		return nil, fmt.Errorf("invalid condition %s , missing field at %d", p.s, start)
+	}
+
+	p.space()
+	var op string
+	for _, item := range clauseOp {
+		if p.take(item) {
+			op = item
+			break
+		}
+	}
+
+	if op == "" {
+		return nil, fmt.Errorf("invalid condition %s , missing operator after %s", p.s, key)
+	}
+
+	p.space()
+	val, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "=":
+		return newFilter(key, val), nil
+	case "!=":
+		m := newFilter(key, val)
+		return func(ev *Event) bool { return !m(ev) }, nil
+	default:
+		return newCompare(key, op, val)
+	}
+}
+
+// value 引号中的值支持 \" 和 \\ 转义 没有引号的值到下一个 && 或者 || 为止
+func (p *condParser) value() (string, error) {
+	if !p.eof() && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		quote := p.s[p.i]
+		p.i++
+
+		var b strings.Builder
+		for !p.eof() {
+			c := p.s[p.i]
+			p.i++
+			switch {
+			case c == '\\' && !p.eof():
+				b.WriteByte(p.s[p.i])
+				p.i++
+			case c == quote:
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("invalid condition %s , unterminated quote", p.s)
+	}
+
+	start := p.i
+	for !p.eof() && !strings.HasPrefix(p.s[p.i:], "&&") && !strings.HasPrefix(p.s[p.i:], "||") {
+		p.i++
+	}
+
+	val := strings.TrimSpace(p.s[start:p.i])
+	if val == "" {
+		return "", fmt.Errorf("invalid condition %s , missing value at %d", p.s, start)
+	}
+	return val, nil
+}
+
+func newCompare(key, op, val string) (match, error) {
+	var field func(*Event) (float64, bool)
+	var want float64
+
+	if key == "level" {
+		sev, ok := ParseSeverity(val)
+		if !ok {
+			return nil, fmt.Errorf("invalid level %s", val)
+		}
+		want = float64(sev)
+		field = func(ev *Event) (float64, bool) {
+			return float64(ev.level), true
+		}
+	} else {
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", val)
+		}
+		want = n
+		field = func(ev *Event) (float64, bool) {
+			n, err := strconv.ParseFloat(ev.Field(key), 64)
+			return n, err == nil
+		}
+	}
+
+	return func(ev *Event) bool {
+		v, ok := field(ev)
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case ">":
+			return v > want
+		case ">=":
+			return v >= want
+		case "<":
+			return v < want
+		default:
+			return v <= want
+		}
+	}, nil
+}
+
+// checkSeverity 等级的数值 , 中文或者英文名称
+func checkSeverity(L *lua.LState, v string) Severity {
+	s, ok := ParseSeverity(v)
+	if !ok {
+		L.RaiseError("invalid level %s", v)
+		return SeverityUnknown
+	}
+	return s
+}
+
+// NewCondition 编译过滤表达式 语法和 adt.pass(expr) , inhibit when 相同
+func NewCondition(expr string) (Filter, error) {
+	m, err := newCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	return FilterFunc(m), nil
+}
+
+func checkCondition(L *lua.LState, expr string) match {
+	m, err := newCondition(expr)
+	if err != nil {
+		L.RaiseError("%v", err)
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,86 @@
+package audit_test
+
+import (
+	"errors"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestNewCondition(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	login := adt.NewEvent("login").From("sshd").User("root").Remote("10.0.0.1").Port(22).
+		Msg("a >= b && c || d").SetSeverity(audit.SeverityHigh)
+	file := adt.NewEvent("file").From("fim").Attr("note", `say "hi"`).
+		E(errors.New("denied")).SetSeverity(audit.SeverityLow)
+
+	cases := []struct {
+		expr  string
+		login bool
+		file  bool
+	}{
+		{"typeof = login", true, false},
+		{"typeof = log*", true, false},
+		{"typeof != log*", false, true},
+		{"remote_port = 22", true, false},
+		{"remote_port > 21", true, false},
+		{"remote_port >= 22", true, false},
+		{"remote_port < 22", false, true},
+		{"remote_port <= 22", true, true},
+		{"level = 重要", true, false},
+		{"level = high", true, false},
+		{"level = 3", true, false},
+		{"level >= 次要", true, true},
+		{"level > low", true, false},
+		{"level < 3", false, true},
+		{"typeof = file && from = sshd", false, false},
+		{"typeof = file && from = fim || user = root", true, true},
+		{"user = root || typeof = file && from = sshd", true, false},
+		{`msg = "a >= b && c || d"`, true, false},
+		{`msg = 'a >= b && c || d' && typeof = login`, true, false},
+		{`attr.note = "say \"hi\""`, false, true},
+		{`attr.note = 'say "hi"'`, false, true},
+		{"error = denied", false, true},
+		{"error.type = *errorString", false, true},
+		{"  typeof=login&&user=root  ", true, false},
+	}
+
+	for _, c := range cases {
+		f, err := audit.NewCondition(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+
+		if got := f.Match(login); got != c.login {
+			t.Fatalf("%s match login expect %v , got %v", c.expr, c.login, got)
+		}
+
+		if got := f.Match(file); got != c.file {
+			t.Fatalf("%s match file expect %v , got %v", c.expr, c.file, got)
+		}
+	}
+}
+
+func TestNewConditionInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"   ",
+		"typeof",
+		"typeof login",
+		"= login",
+		"typeof =",
+		"typeof = login &&",
+		"typeof = login || ",
+		`msg = "open`,
+		`msg = "a" user = root`,
+		"level >= urgent",
+		"remote_port > abc",
+	}
+
+	for _, expr := range cases {
+		if _, err := audit.NewCondition(expr); err == nil {
+			t.Fatalf("%q expect error", expr)
+		}
+	}
+}
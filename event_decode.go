@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05",
+}
+
+func decodeTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case string:
+		for _, layout := range timeLayouts {
+			if tm, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return tm
+			}
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return time.Unix(n, 0)
+		}
+	}
+	return time.Time{}
+}
+
+func decodeString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+func decodeInt(v interface{}) int {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := strconv.Atoi(n.String())
+		return i
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+func decodeBool(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	}
+	return false
+}
+
+// DecodeEvent 解析 Byte() 输出的vela格式事件 用于本地存储和离线工具
+func DecodeEvent(raw []byte) (*Event, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, errors.New("empty event")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	m := make(map[string]interface{})
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	ev := &Event{
+		uid:     decodeString(m["event_id"]),
+		trace:   decodeString(m["trace_id"]),
+		parent:  decodeString(m["parent_id"]),
+		time:    decodeTime(m["time"]),
+		id:      decodeString(m["node_id"]),
+		inet:    decodeString(m["inet"]),
+		subject: decodeString(m["subject"]),
+		rAddr:   decodeString(m["remote_addr"]),
+		rPort:   decodeInt(m["remote_port"]),
+		region:  decodeString(m["region"]),
+		from:    decodeString(m["from"]),
+		typeof:  decodeString(m["typeof"]),
+		user:    decodeString(m["user"]),
+		auth:    decodeString(m["auth"]),
+		msg:     decodeString(m["msg"]),
+		ref:     decodeString(m["msg_ref"]),
+		size:    decodeInt(m["msg_size"]),
+		alert:   decodeBool(m["alert"]),
+		rolled:  true,
+	}
+
+	// severity 是数值 优先使用 旧的日志只有中文名称
+	if sev, ok := m["severity"].(json.Number); ok {
+		ev.SetSeverity(Severity(decodeInt(sev)))
+	} else if sev, ok := ParseSeverity(decodeString(m["level"])); ok {
+		ev.SetSeverity(sev)
+	} else {
+		ev.level = SeverityInfo
+	}
+
+	ev.err, ev.stack = decodeError(m["error"])
+
+	if rate, ok := m["sample_rate"].(json.Number); ok {
+		ev.rate, _ = rate.Float64()
+	}
+
+	if _, ok := m["count"]; ok {
+		ev.roll = &rollupInfo{
+			count: decodeInt(m["count"]),
+			first: decodeTime(m["first_time"]),
+			last:  decodeTime(m["last_time"]),
+		}
+
+		samples, _ := m["samples"].(map[string]interface{})
+		for _, field := range sortedKeys(samples) {
+			ev.roll.samples = append(ev.roll.samples, rollupSample{
+				field:  field,
+				values: splitSample(decodeString(samples[field])),
+			})
+		}
+	}
+
+	attrs, _ := m["attrs"].(map[string]interface{})
+	for _, key := range sortedKeys(attrs) {
+		ev.attrs = append(ev.attrs, attr{key: key, val: decodeString(attrs[key])})
+	}
+
+	return ev, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitSample(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"github.com/vela-security/vela-public/kind"
+)
+
+// ecsLevel event.severity 直接使用等级数值 log.level 使用syslog的名称
+func ecsLevel(s Severity) string {
+	switch s {
+	case SeverityCritical:
+		return "critical"
+	case SeveritySerious, SeverityHigh:
+		return "error"
+	case SeverityLow:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// ECS 按照 Elastic Common Schema 输出 字段采用点分格式
+func (ev *Event) ECS() []byte {
+	return ev.ecs(ev.schema())
+}
+
+func (ev *Event) ecs(s *schema) []byte {
+	if ev == nil {
+		return []byte{}
+	}
+
+	kd := "event"
+	if ev.alert {
+		kd = "alert"
+	}
+
+	buf := kind.NewJsonEncoder()
+	buf.Tab("")
+	buf.KV("@timestamp", ev.time)
+	buf.KV("event.id", ev.uid)
+	if ev.trace != "" {
+		buf.KV("trace.id", ev.trace)
+	}
+	if ev.parent != "" {
+		buf.KV("vela.parent_id", ev.parent)
+	}
+	buf.KV("message", ev.msg)
+	buf.KV("ecs.version", "8.11.0")
+	buf.KV("event.kind", kd)
+	buf.KV("event.category", s.Category(ev.typeof))
+	buf.KV("event.action", ev.typeof)
+	buf.KV("event.module", "vela")
+	buf.KV("event.provider", ev.from)
+	buf.KI("event.severity", int(ev.level))
+	buf.KV("log.level", ecsLevel(ev.level))
+	if ev.rate > 0 && ev.rate < 1 {
+		buf.KV("vela.sample_rate", ev.rate)
+	}
+	if ev.roll != nil {
+		buf.KV("event.start", ev.roll.first)
+		buf.KV("event.end", ev.roll.last)
+		buf.KI("vela.count", ev.roll.count)
+	}
+	buf.KV("host.id", ev.id)
+	buf.KV("host.ip", ev.inet)
+
+	if ev.rAddr != "" {
+		buf.KV("source.ip", ev.rAddr)
+		buf.KI("source.port", ev.rPort)
+		buf.KV("source.geo.name", ev.region)
+	}
+
+	if ev.user != "" {
+		buf.KV("user.name", ev.user)
+	}
+
+	if ev.err != nil {
+		buf.KV("error.message", ev.err.Error())
+		buf.KV("error.type", errorType(ev.err))
+		if ev.stack != "" {
+			buf.KV("error.stack_trace", ev.stack)
+		}
+	}
+
+	if ev.ref != "" {
+		buf.KV("vela.msg_ref", ev.ref)
+		buf.KI("vela.msg_size", ev.size)
+	}
+	buf.KV("vela.subject", ev.subject)
+	buf.KV("vela.auth", ev.auth)
+	buf.KV("vela.level", ev.level.Label(s.Lang(FormatECS)))
+	for _, a := range ev.attrs {
+		buf.KV("labels."+a.key, a.val)
+	}
+	buf.End("}")
+	return buf.Bytes()
+}
@@ -0,0 +1,190 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	audit "github.com/vela-security/vela-audit"
+	"github.com/vela-security/vela-audit/audittest"
+)
+
+// decode 把输出解析成点分的字段 嵌套的对象展开成 a.b.c
+func decode(t *testing.T, raw []byte) map[string]string {
+	t.Helper()
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("invalid json %s: %v", raw, err)
+	}
+
+	out := make(map[string]string)
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, val := range m {
+			if sub, ok := val.(map[string]interface{}); ok {
+				walk(prefix+k+".", sub)
+				continue
+			}
+			out[prefix+k] = fmt.Sprint(val)
+		}
+	}
+	walk("", v)
+	return out
+}
+
+func expectFields(t *testing.T, name string, got map[string]string, want map[string]string) {
+	t.Helper()
+
+	for k, v := range want {
+		val, ok := got[k]
+		if v == "" {
+			if ok {
+				t.Fatalf("%s expect no %s , got %q", name, k, val)
+			}
+			continue
+		}
+		if val != v {
+			t.Fatalf("%s expect %s = %q , got %q", name, k, v, val)
+		}
+	}
+}
+
+func TestECSFields(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	cases := []struct {
+		name  string
+		build func() *audit.Event
+		want  map[string]string
+	}{
+		{"login", func() *audit.Event {
+			return adt.NewEvent("login").User("root").Remote("10.0.0.1").Port(22).SetSeverity(audit.SeverityLow)
+		}, map[string]string{
+			"event.kind":     "event",
+			"event.category": "authentication",
+			"event.action":   "login",
+			"event.severity": "2",
+			"log.level":      "warning",
+			"host.id":        audittest.ID,
+			"user.name":      "root",
+			"source.ip":      "10.0.0.1",
+			"source.port":    "22",
+			"error.message":  "",
+		}},
+		{"alert", func() *audit.Event {
+			return adt.NewEvent("portscan").Alert().SetSeverity(audit.SeverityCritical)
+		}, map[string]string{
+			"event.kind":     "alert",
+			"event.category": "network",
+			"event.severity": "5",
+			"log.level":      "critical",
+			"user.name":      "",
+		}},
+		{"error", func() *audit.Event {
+			return adt.NewEvent("file").E(errors.New("denied")).SetSeverity(audit.SeveritySerious)
+		}, map[string]string{
+			"event.category": "file",
+			"event.severity": "4",
+			"log.level":      "error",
+			"error.message":  "denied",
+			"error.type":     "*errors.errorString",
+		}},
+		{"unmapped", func() *audit.Event {
+			return adt.NewEvent("custom").Attr("path", "/etc/passwd")
+		}, map[string]string{
+			"event.category": "host",
+			"log.level":      "info",
+			"labels.path":    "/etc/passwd",
+			"event.start":    "",
+		}},
+	}
+
+	for _, c := range cases {
+		expectFields(t, c.name, decode(t, c.build().ECS()), c.want)
+	}
+}
+
+func TestOCSFFields(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	cases := []struct {
+		name  string
+		build func() *audit.Event
+		want  map[string]string
+	}{
+		{"login", func() *audit.Event {
+			return adt.NewEvent("login").User("root").Remote("10.0.0.1").Port(22).SetSeverity(audit.SeverityHigh)
+		}, map[string]string{
+			"class_uid":         "3002",
+			"category_uid":      "3",
+			"type_uid":          "300299",
+			"severity_id":       "3",
+			"severity":          "Medium",
+			"device.uid":        audittest.ID,
+			"actor.user.name":   "root",
+			"src_endpoint.ip":   "10.0.0.1",
+			"src_endpoint.port": "22",
+			"status":            "",
+		}},
+		{"critical", func() *audit.Event {
+			return adt.NewEvent("process").SetSeverity(audit.SeverityCritical)
+		}, map[string]string{
+			"class_uid":   "1007",
+			"severity_id": "5",
+			"severity":    "Critical",
+		}},
+		{"error", func() *audit.Event {
+			return adt.NewEvent("file").E(errors.New("denied")).SetSeverity(audit.SeveritySerious)
+		}, map[string]string{
+			"class_uid":           "1001",
+			"severity_id":         "4",
+			"severity":            "High",
+			"status":              "Failure",
+			"status_detail":       "denied",
+			"unmapped.error_type": "*errors.errorString",
+		}},
+		{"collision", func() *audit.Event {
+			return adt.NewEvent("custom").Attr("level", "x").Attr("path", "/tmp")
+		}, map[string]string{
+			"class_uid":           "0",
+			"severity_id":         "1",
+			"unmapped.level":      audit.SeverityInfo.Label(audit.LangZH),
+			"unmapped.attr.level": "x",
+			"unmapped.path":       "/tmp",
+		}},
+	}
+
+	for _, c := range cases {
+		expectFields(t, c.name, decode(t, c.build().OCSF()), c.want)
+	}
+}
+
+// 合并的事件带上窗口的开始结束时间和合并数量
+func TestRollupFields(t *testing.T) {
+	adt, env, rec := newAudit(t)
+	if err := adt.SetRollup("$typeof", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		adt.NewEvent("portscan").Alert().Put()
+	}
+	env.Clock.Advance(11 * time.Second)
+	if n := adt.ExpireRollup(); n != 1 {
+		t.Fatalf("expect 1 rollup event , got %d", n)
+	}
+
+	ev := rec.ExpectAlert(t, "portscan")
+	ecs := decode(t, ev.ECS())
+	if ecs["vela.count"] != "2" || ecs["event.start"] == "" || ecs["event.end"] == "" {
+		t.Fatalf("expect rollup fields in ecs , got %v", ecs)
+	}
+
+	ocsf := decode(t, ev.OCSF())
+	if ocsf["count"] != "2" || ocsf["start_time"] == "" || ocsf["end_time"] == "" {
+		t.Fatalf("expect rollup fields in ocsf , got %v", ocsf)
+	}
+}
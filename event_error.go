@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vela-security/vela-public/catch"
+	"github.com/vela-security/vela-public/kind"
+	"strings"
+)
+
+// causeError 解码或者从lua传入的错误 保留原来的类型名称和包装链
+type causeError struct {
+	msg  string
+	typ  string
+	next *causeError
+}
+
+func (e *causeError) Error() string {
+	return e.msg
+}
+
+func (e *causeError) Unwrap() error {
+	if e.next == nil {
+		return nil
+	}
+	return e.next
+}
+
+// errorLink 错误链中的一环
+type errorLink struct {
+	msg string
+	typ string
+}
+
+func errorType(err error) string {
+	if ce, ok := err.(*causeError); ok {
+		return ce.typ
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// walkError 先访问错误本身 再按顺序访问 Unwrap 得到的原因 errors.Join 的多个原因依次展开
+func walkError(err error, fn func(error)) {
+	var walk func(error, int)
+	walk = func(e error, depth int) {
+		if e == nil || depth > 32 {
+			return
+		}
+
+		fn(e)
+		switch u := e.(type) {
+		case interface{ Unwrap() []error }:
+			for _, item := range u.Unwrap() {
+				walk(item, depth+1)
+			}
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap(), depth+1)
+		}
+	}
+	walk(err, 0)
+}
+
+// errorChain 第一个是事件的错误本身 之后是通过 Unwrap 得到的原因
+func errorChain(err error) []errorLink {
+	var chain []errorLink
+	walkError(err, func(e error) {
+		chain = append(chain, errorLink{msg: e.Error(), typ: errorType(e)})
+	})
+	return chain
+}
+
+// newCauseError 按照错误链重建 第一个元素是最外层的错误
+func newCauseError(chain []errorLink) error {
+	var next *causeError
+	for i := len(chain) - 1; i >= 0; i-- {
+		next = &causeError{msg: chain[i].msg, typ: chain[i].typ, next: next}
+	}
+	if next == nil {
+		return nil
+	}
+	return next
+}
+
+// Stack 记录当前调用栈 和 E 一起使用 输出在 error.stack
+func (ev *Event) Stack() *Event {
+	ev.stack = catch.StackTrace(0)
+	return ev
+}
+
+// ErrorType 最外层错误的类型
+func (ev *Event) ErrorType() string {
+	if ev.err == nil {
+		return ""
+	}
+	return errorType(ev.err)
+}
+
+// Cause 最里层的原因 返回包装链中原来的error errors.Is , errors.As 可以直接使用
+func (ev *Event) Cause() error {
+	var cause error
+	walkError(ev.err, func(e error) { cause = e })
+	return cause
+}
+
+func (ev *Event) errorField(key string) string {
+	if ev.err == nil {
+		return ""
+	}
+
+	switch key {
+	case "error.type":
+		return errorType(ev.err)
+	case "error.cause":
+		chain := errorChain(ev.err)
+		return chain[len(chain)-1].msg
+	case "error.cause_type":
+		chain := errorChain(ev.err)
+		return chain[len(chain)-1].typ
+	case "error.chain":
+		chain := errorChain(ev.err)
+		msgs := make([]string, len(chain))
+		for i, l := range chain {
+			msgs[i] = l.msg
+		}
+		return strings.Join(msgs, " <- ")
+	case "error.stack":
+		return ev.stack
+	}
+	return ""
+}
+
+// encodeError error 对象 message , type , chain , stack
+func (ev *Event) encodeError(buf *kind.JsonEncoder) {
+	if ev.err == nil {
+		return
+	}
+
+	chain := errorChain(ev.err)
+	buf.Tab("error")
+	buf.KV("message", chain[0].msg)
+	buf.KV("type", chain[0].typ)
+	if len(chain) > 1 {
+		buf.Arr("chain")
+		for _, l := range chain[1:] {
+			buf.Tab("")
+			buf.KV("message", l.msg)
+			buf.KV("type", l.typ)
+			buf.End("},")
+		}
+		buf.End("],")
+	}
+	if ev.stack != "" {
+		buf.KV("stack", ev.stack)
+	}
+	buf.End("},")
+}
+
+// decodeError 兼容旧的字符串格式
+func decodeError(v interface{}) (error, string) {
+	switch e := v.(type) {
+	case string:
+		if e == "" {
+			return nil, ""
+		}
+		return errors.New(e), ""
+
+	case map[string]interface{}:
+		chain := []errorLink{{msg: decodeString(e["message"]), typ: decodeString(e["type"])}}
+		items, _ := e["chain"].([]interface{})
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			chain = append(chain, errorLink{msg: decodeString(m["message"]), typ: decodeString(m["type"])})
+		}
+		return newCauseError(chain), decodeString(e["stack"])
+	}
+	return nil, ""
+}
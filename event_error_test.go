@@ -0,0 +1,53 @@
+package audit_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+type codeError struct{ code int }
+
+func (e *codeError) Error() string { return fmt.Sprintf("code %d", e.code) }
+
+func TestEventCause(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	root := &fs.PathError{Op: "open", Path: "/etc/shadow", Err: fs.ErrPermission}
+	ev := adt.NewEvent("file").E(fmt.Errorf("read config: %w", root))
+	if cause := ev.Cause(); !errors.Is(cause, fs.ErrPermission) {
+		t.Fatalf("expect cause is fs.ErrPermission , got %v", cause)
+	}
+
+	ev = adt.NewEvent("http").E(fmt.Errorf("request: %w", &codeError{code: 502}))
+	var ce *codeError
+	if !errors.As(ev.Cause(), &ce) || ce.code != 502 {
+		t.Fatalf("expect cause as *codeError , got %T", ev.Cause())
+	}
+
+	if adt.NewEvent("file").Cause() != nil {
+		t.Fatal("expect nil cause without error")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	adt, _, rec := newAudit(t)
+
+	func() {
+		defer audit.Recover(adt.NewEvent("panic"))
+		panic("boom")
+	}()
+
+	ev := rec.ExpectEvent(t, "panic")
+	if msg := ev.Field("msg"); msg != "boom" {
+		t.Fatalf("expect msg boom , got %q", msg)
+	}
+
+	if stack := ev.Field("error.stack"); !strings.Contains(stack, "TestRecover") {
+		t.Fatalf("expect stack in error.stack , got %q", stack)
+	}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulid 单调递增的ULID 同一毫秒内随机部分加一 保证按照时间排序
+type ulid struct {
+	mu   sync.Mutex
+	ms   uint64
+	rand [10]byte
+}
+
+var eventID = &ulid{}
+
+func (u *ulid) next(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	u.mu.Lock()
+	if ms > u.ms {
+		u.ms = ms
+		if _, err := rand.Read(u.rand[:]); err != nil {
+			binaryTime(u.rand[:], uint64(time.Now().UnixNano()))
+		}
+	} else {
+		//时钟回拨或者同一毫秒 沿用上一次的时间戳
+		ms = u.ms
+		u.incr()
+	}
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	copy(id[6:], u.rand[:])
+	u.mu.Unlock()
+
+	return encodeULID(id)
+}
+
+func (u *ulid) incr() {
+	for i := len(u.rand) - 1; i >= 0; i-- {
+		u.rand[i]++
+		if u.rand[i] != 0 {
+			return
+		}
+	}
+}
+
+func binaryTime(b []byte, v uint64) {
+	for i := range b {
+		b[i] = byte(v >> (uint(i%8) * 8))
+	}
+}
+
+func encodeULID(id [16]byte) string {
+	var dst [26]byte
+	dst[0] = crockford[(id[0]&224)>>5]
+	dst[1] = crockford[id[0]&31]
+	dst[2] = crockford[(id[1]&248)>>3]
+	dst[3] = crockford[((id[1]&7)<<2)|((id[2]&192)>>6)]
+	dst[4] = crockford[(id[2]&62)>>1]
+	dst[5] = crockford[((id[2]&1)<<4)|((id[3]&240)>>4)]
+	dst[6] = crockford[((id[3]&15)<<1)|((id[4]&128)>>7)]
+	dst[7] = crockford[(id[4]&124)>>2]
+	dst[8] = crockford[((id[4]&3)<<3)|((id[5]&224)>>5)]
+	dst[9] = crockford[id[5]&31]
+
+	dst[10] = crockford[(id[6]&248)>>3]
+	dst[11] = crockford[((id[6]&7)<<2)|((id[7]&192)>>6)]
+	dst[12] = crockford[(id[7]&62)>>1]
+	dst[13] = crockford[((id[7]&1)<<4)|((id[8]&240)>>4)]
+	dst[14] = crockford[((id[8]&15)<<1)|((id[9]&128)>>7)]
+	dst[15] = crockford[(id[9]&124)>>2]
+	dst[16] = crockford[((id[9]&3)<<3)|((id[10]&224)>>5)]
+	dst[17] = crockford[id[10]&31]
+	dst[18] = crockford[(id[11]&248)>>3]
+	dst[19] = crockford[((id[11]&7)<<2)|((id[12]&192)>>6)]
+	dst[20] = crockford[(id[12]&62)>>1]
+	dst[21] = crockford[((id[12]&1)<<4)|((id[13]&240)>>4)]
+	dst[22] = crockford[((id[13]&15)<<1)|((id[14]&128)>>7)]
+	dst[23] = crockford[(id[14]&124)>>2]
+	dst[24] = crockford[((id[14]&3)<<3)|((id[15]&224)>>5)]
+	dst[25] = crockford[id[15]&31]
+	return string(dst[:])
+}
+
+// EventID 事件唯一ID 按照时间排序 区别于节点ID
+func (ev *Event) EventID() string {
+	return ev.uid
+}
+
+func (ev *Event) TraceID() string {
+	return ev.trace
+}
+
+func (ev *Event) ParentID() string {
+	return ev.parent
+}
+
+func (ev *Event) Trace(id string) *Event {
+	ev.trace = id
+	return ev
+}
+
+// Parent 关联到引起当前事件的父事件 trace_id 沿用父事件的 没有的话使用父事件ID
+func (ev *Event) Parent(p *Event) *Event {
+	if p == nil {
+		return ev
+	}
+
+	ev.parent = p.uid
+	ev.trace = p.trace
+	if ev.trace == "" {
+		ev.trace = p.uid
+	}
+	return ev
+}
+
+// Child 创建子事件 继承审计对象和来源
+func (ev *Event) Child(typeof string) *Event {
+	var c *Event
+	if ev.adt != nil {
+		c = ev.adt.NewEvent(typeof)
+	} else {
+		c = NewEvent(typeof)
+	}
+	return c.From(ev.from).Parent(ev)
+}
+
+// EventIDTime 事件ID中记录的毫秒时间 不是合法的ULID时返回false
+func EventIDTime(id string) (time.Time, bool) {
+	tm, ok := ulidTime(id)
+	if !ok {
+		return tm, false
+	}
+
+	for i := 10; i < len(id); i++ {
+		if strings.IndexByte(crockford, id[i]) < 0 {
+			return time.Time{}, false
+		}
+	}
+	return tm, true
+}
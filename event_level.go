@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Severity 事件等级 数值越大越严重 过滤和限速按照数值比较
+// 1-5 和旧的 Notice , Middle , High , Serious , Disaster 一一对应 名称不变 0 是新增的未知
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityInfo
+	SeverityLow
+	SeverityHigh
+	SeveritySerious
+	SeverityCritical
+)
+
+const (
+	LangZH = "zh"
+	LangEN = "en"
+)
+
+// severityLabels 等级的本地化名称 下标就是等级的数值
+var severityLabels = map[string][]string{
+	LangZH: {"未知", NOTICE, MIDDLE, HIGH, SERIOUS, DISASTER},
+	LangEN: {"unknown", "info", "low", "high", "serious", "critical"},
+}
+
+// severityAlias 旧配置中使用过的英文名称
+var severityAlias = map[string]Severity{
+	"notice":   SeverityInfo,
+	"middle":   SeverityLow,
+	"disaster": SeverityCritical,
+}
+
+func (s Severity) valid() bool {
+	return s >= SeverityUnknown && s <= SeverityCritical
+}
+
+// Label 按照语言输出等级名称 不支持的语言使用中文
+func (s Severity) Label(lang string) string {
+	if !s.valid() {
+		s = SeverityUnknown
+	}
+
+	labels, ok := severityLabels[lang]
+	if !ok {
+		labels = severityLabels[LangZH]
+	}
+	return labels[s]
+}
+
+func (s Severity) String() string {
+	return s.Label(LangEN)
+}
+
+// ParseSeverity 支持数值 0-5 , 中文名称 , 英文名称
+func ParseSeverity(v string) (Severity, bool) {
+	v = strings.TrimSpace(v)
+	if n, err := strconv.Atoi(v); err == nil {
+		s := Severity(n)
+		return s, s.valid()
+	}
+
+	lower := strings.ToLower(v)
+	for _, labels := range severityLabels {
+		for i, label := range labels {
+			if label == lower {
+				return Severity(i), true
+			}
+		}
+	}
+
+	s, ok := severityAlias[lower]
+	return s, ok
+}
+
+func checkLang(v string) bool {
+	_, ok := severityLabels[v]
+	return ok
+}
@@ -0,0 +1,90 @@
+package audit_test
+
+import (
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+// 旧的构造方法和等级名称 数值固定 不能因为新增等级而移动
+func TestLegacyLevel(t *testing.T) {
+	adt, _, _ := newAudit(t)
+
+	cases := []struct {
+		name  string
+		build func(*audit.Event) *audit.Event
+		label string
+		want  audit.Severity
+		en    string
+	}{
+		{"Notice", (*audit.Event).Notice, audit.NOTICE, audit.SeverityInfo, "info"},
+		{"Middle", (*audit.Event).Middle, audit.MIDDLE, audit.SeverityLow, "low"},
+		{"High", (*audit.Event).High, audit.HIGH, audit.SeverityHigh, "high"},
+		{"Serious", (*audit.Event).Serious, audit.SERIOUS, audit.SeveritySerious, "serious"},
+		{"Disaster", (*audit.Event).Disaster, audit.DISASTER, audit.SeverityCritical, "critical"},
+	}
+
+	for i, c := range cases {
+		ev := c.build(adt.NewEvent("test"))
+		if ev.Severity() != c.want || int(c.want) != i+1 {
+			t.Fatalf("%s expect %d , got %d", c.name, c.want, ev.Severity())
+		}
+
+		lv := adt.NewEvent("test")
+		lv.Level(i)
+		if lv.Severity() != c.want {
+			t.Fatalf("Level(%d) expect %d , got %d", i, c.want, lv.Severity())
+		}
+
+		if s, ok := audit.ParseSeverity(c.label); !ok || s != c.want {
+			t.Fatalf("label %s expect %d , got %d", c.label, c.want, s)
+		}
+
+		if c.want.Label(audit.LangEN) != c.en || c.want.Label(audit.LangZH) != c.label {
+			t.Fatalf("%s expect label %s %s , got %s %s", c.name, c.en, c.label,
+				c.want.Label(audit.LangEN), c.want.Label(audit.LangZH))
+		}
+
+		f, err := audit.NewCondition("level = " + c.en)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Match(ev) {
+			t.Fatalf("level = %s not match %s()", c.en, c.name)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	cases := []struct {
+		in   string
+		want audit.Severity
+		ok   bool
+	}{
+		{"0", audit.SeverityUnknown, true},
+		{"3", audit.SeverityHigh, true},
+		{" 5 ", audit.SeverityCritical, true},
+		{"6", 0, false},
+		{"-1", 0, false},
+		{"未知", audit.SeverityUnknown, true},
+		{"重要", audit.SeverityHigh, true},
+		{"严重", audit.SeveritySerious, true},
+		{"unknown", audit.SeverityUnknown, true},
+		{"INFO", audit.SeverityInfo, true},
+		{"high", audit.SeverityHigh, true},
+		{"Serious", audit.SeveritySerious, true},
+		{"critical", audit.SeverityCritical, true},
+		{"notice", audit.SeverityInfo, true},
+		{"middle", audit.SeverityLow, true},
+		{"disaster", audit.SeverityCritical, true},
+		{"medium", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		s, ok := audit.ParseSeverity(c.in)
+		if ok != c.ok || (ok && s != c.want) {
+			t.Fatalf("ParseSeverity(%q) expect %d %v , got %d %v", c.in, c.want, c.ok, s, ok)
+		}
+	}
+}
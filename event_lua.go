@@ -81,18 +81,79 @@ func (ev *Event) portL(L *lua.LState) int {
 	return ev.ret(L)
 }
 
+/*
+	ev.E("connect fail")
+	ev.E({message = "login fail" , type = "auth" , cause = {message = "connection refused" , type = "net"}})
+*/
+
+func toError(val lua.LValue) error {
+	switch v := val.(type) {
+	case *lua.AnyData:
+		if e, ok := v.Data.(error); ok {
+			return e
+		}
+	case *lua.LTable:
+		return newCauseError(tableChain(v, nil))
+	}
+	return errors.New(val.String())
+}
+
+// tableChain cause 可以是字符串或者嵌套的table
+func tableChain(tab *lua.LTable, chain []errorLink) []errorLink {
+	link := errorLink{msg: tabString(tab, "message"), typ: "lua"}
+	if typ := tab.RawGetString("type"); typ.Type() == lua.LTString {
+		link.typ = typ.String()
+	}
+	chain = append(chain, link)
+
+	if len(chain) > 32 {
+		return chain
+	}
+
+	switch cause := tab.RawGetString("cause").(type) {
+	case *lua.LTable:
+		return tableChain(cause, chain)
+	case lua.LString:
+		return append(chain, errorLink{msg: string(cause), typ: "lua"})
+	}
+	return chain
+}
+
 func (ev *Event) errL(L *lua.LState) int {
 	val := L.Get(1)
 	switch val.Type() {
 	case lua.LTNil:
 		//
 	default:
-		ev.E(errors.New(val.String()))
+		ev.E(toError(val))
 	}
 
 	return ev.ret(L)
 }
 
+func (ev *Event) attrL(L *lua.LState) int {
+	ev.Attr(L.CheckString(1), L.Get(2).String())
+	return ev.ret(L)
+}
+
+func (ev *Event) traceL(L *lua.LState) int {
+	ev.Trace(L.CheckString(1))
+	return ev.ret(L)
+}
+
+func (ev *Event) parentL(L *lua.LState) int {
+	if p := CheckEvent(L, 1); p != nil {
+		ev.Parent(p)
+	}
+	return ev.ret(L)
+}
+
+func (ev *Event) childL(L *lua.LState) int {
+	c := ev.Child(L.CheckString(1))
+	L.Push(c)
+	return 1
+}
+
 func (ev *Event) logL(L *lua.LState) int {
 	if !L.IsFalse(1) {
 		ev.Log()
@@ -113,7 +174,7 @@ func (ev *Event) putL(L *lua.LState) int {
 	}
 
 	if n >= 3 {
-		ev.Level(L.IsInt(3))
+		ev.levelV(L, L.Get(3))
 	}
 
 	ev.Put()
@@ -121,10 +182,20 @@ func (ev *Event) putL(L *lua.LState) int {
 }
 
 func (ev *Event) levelL(L *lua.LState) int {
-	ev.Level(L.IsInt(1))
+	ev.levelV(L, L.Get(1))
 	return ev.ret(L)
 }
 
+// levelV 数字按照 Level 的旧参数处理 字符串支持中文 , 英文名称 未知和 SetSeverity 一样按照普通处理
+func (ev *Event) levelV(L *lua.LState, val lua.LValue) {
+	switch val.Type() {
+	case lua.LTNumber, lua.LTInt:
+		ev.Level(lua.IsInt(val))
+	default:
+		ev.SetSeverity(checkSeverity(L, val.String()))
+	}
+}
+
 func (ev *Event) alertL(L *lua.LState) int {
 	ev.alert = L.IsFalse(1)
 	return ev.ret(L)
@@ -135,12 +206,18 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "ID":
 		return lua.S2L(ev.id)
+	case "event_id":
+		return lua.S2L(ev.uid)
+	case "trace_id":
+		return lua.S2L(ev.trace)
+	case "parent_id":
+		return lua.S2L(ev.parent)
 	case "inet":
 		return lua.S2L(ev.inet)
 	case "time":
 		v, e := ev.time.MarshalJSON()
 		if e != nil {
-			xEnv.Errorf("Event time to json error %v", e)
+			ev.env().Errorf("Event time to json error %v", e)
 			return lua.LSNull
 		}
 		return lua.B2L(v)
@@ -157,6 +234,12 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 	case "auth":
 		return lua.S2L(ev.auth)
 
+	case "msg_ref":
+		return lua.S2L(ev.ref)
+
+	case "msg_size":
+		return lua.LInt(ev.size)
+
 	case "msg":
 		return lua.S2L(ev.msg)
 
@@ -169,6 +252,12 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 	case "string":
 		return lua.B2L(ev.Byte())
 
+	case "ecs":
+		return lua.B2L(ev.ECS())
+
+	case "ocsf":
+		return lua.B2L(ev.OCSF())
+
 	case "from":
 		return lua.S2L(ev.from)
 
@@ -179,9 +268,27 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 
 		return lua.S2L(ev.err.Error())
 
+	case "error_type":
+		return lua.S2L(ev.errorField("error.type"))
+
+	case "cause":
+		return lua.S2L(ev.errorField("error.cause"))
+
+	case "error_chain":
+		return lua.S2L(ev.errorField("error.chain"))
+
+	case "stack":
+		return lua.S2L(ev.stack)
+
 	case "region":
 		return lua.S2L(ev.region)
 
+	case "level":
+		return lua.S2L(ev.level.Label(LangZH))
+
+	case "severity":
+		return lua.LInt(ev.level)
+
 	case "alert":
 		return lua.LBool(ev.alert)
 
@@ -216,6 +323,18 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 	case "E":
 		return L.NewFunction(ev.errL)
 
+	case "Attr":
+		return L.NewFunction(ev.attrL)
+
+	case "Trace":
+		return L.NewFunction(ev.traceL)
+
+	case "Parent":
+		return L.NewFunction(ev.parentL)
+
+	case "Child":
+		return L.NewFunction(ev.childL)
+
 	case "Log":
 		return L.NewFunction(ev.logL)
 
@@ -238,7 +357,7 @@ func (ev *Event) Index(L *lua.LState, key string) lua.LValue {
 func (ev *Event) NewIndex(L *lua.LState, key string, val lua.LValue) {
 	switch key {
 	case "err":
-		ev.E(errors.New(val.String()))
+		ev.E(toError(val))
 
 	case "time":
 		ev.Time(auxlib.ToTime(val.String()))
@@ -277,9 +396,15 @@ func (ev *Event) NewIndex(L *lua.LState, key string, val lua.LValue) {
 	case "auth":
 		ev.auth = val.String()
 	case "level":
-		ev.Level(lua.IsInt(val))
+		ev.levelV(L, val)
+	case "severity":
+		ev.SetSeverity(Severity(lua.IsInt(val)))
 	case "typeof":
 		ev.typeof = val.String()
+	case "trace_id":
+		ev.trace = val.String()
+	case "parent_id":
+		ev.parent = val.String()
 	case "alert":
 		ev.alert = lua.IsTrue(val)
 	}
@@ -299,14 +424,14 @@ func CheckEvent(L *lua.LState, idx int) *Event {
 		ev, ok = v.(*lua.AnyData).Data.(*Event)
 
 	default:
-		xEnv.Errorf("got lua %s , not lua vela-event", v.Type().String())
+		defaultEnv.Errorf("got lua %s , not lua vela-event", v.Type().String())
 		return nil
 	}
 
 	if ok {
 		return ev
 	} else {
-		xEnv.Errorf("not vela-event")
+		defaultEnv.Errorf("not vela-event")
 		return nil
 	}
 }
@@ -7,6 +7,13 @@ import (
 type match func(*Event) bool
 
 func newFilter(key string, pattern string) match {
+	// 等级按照数值比较 普通 , info , 1 是同一个等级
+	if key == "level" {
+		if sev, ok := ParseSeverity(pattern); ok {
+			return func(ev *Event) bool { return ev.level == sev }
+		}
+	}
+
 	filter := grep.New(pattern)
 	return func(ev *Event) bool {
 		val := ev.Field(key)
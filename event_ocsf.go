@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"github.com/vela-security/vela-public/kind"
+)
+
+// ocsfSeverity severity_id 和等级数值一一对应
+func ocsfSeverity(s Severity) (int, string) {
+	switch s {
+	case SeverityCritical:
+		return 5, "Critical"
+	case SeveritySerious:
+		return 4, "High"
+	case SeverityHigh:
+		return 3, "Medium"
+	case SeverityLow:
+		return 2, "Low"
+	case SeverityInfo:
+		return 1, "Informational"
+	default:
+		return 0, "Unknown"
+	}
+}
+
+// ocsfUnmapped unmapped 中固定输出的字段 同名的附加属性加上 attr. 前缀 避免重复的key
+var ocsfUnmapped = map[string]bool{
+	"level": true, "msg_ref": true, "msg_size": true, "error_type": true, "error_chain": true,
+	"subject": true, "from": true, "typeof": true, "auth": true, "alert": true,
+	"parent_id": true, "sample_rate": true,
+}
+
+// OCSF 按照 Open Cybersecurity Schema Framework 输出
+// class_uid 来自typeof映射表 category_uid = class_uid / 1000
+func (ev *Event) OCSF() []byte {
+	return ev.ocsf(ev.schema())
+}
+
+func (ev *Event) ocsf(s *schema) []byte {
+	if ev == nil {
+		return []byte{}
+	}
+
+	class := s.Class(ev.typeof)
+	severity, label := ocsfSeverity(ev.level)
+	activity := 99 //Other
+
+	buf := kind.NewJsonEncoder()
+	buf.Tab("")
+	buf.KI("class_uid", class)
+	buf.KI("category_uid", class/1000)
+	buf.KI("activity_id", activity)
+	buf.KI("type_uid", class*100+activity)
+	buf.KI("severity_id", severity)
+	buf.KV("severity", label)
+	buf.KV("time", ev.time.UnixMilli())
+	buf.KV("message", ev.msg)
+	if ev.roll != nil {
+		buf.KI("count", ev.roll.count)
+		buf.KV("start_time", ev.roll.first.UnixMilli())
+		buf.KV("end_time", ev.roll.last.UnixMilli())
+	}
+
+	buf.Tab("metadata")
+	buf.KV("uid", ev.uid)
+	if ev.trace != "" {
+		buf.KV("correlation_uid", ev.trace)
+	}
+	buf.KV("version", "1.1.0")
+	buf.Tab("product")
+	buf.KV("name", "vela")
+	buf.KV("vendor_name", "vela-security")
+	buf.End("},")
+	buf.End("},")
+
+	buf.Tab("device")
+	buf.KV("uid", ev.id)
+	buf.KV("ip", ev.inet)
+	buf.End("},")
+
+	if ev.rAddr != "" {
+		buf.Tab("src_endpoint")
+		buf.KV("ip", ev.rAddr)
+		buf.KI("port", ev.rPort)
+		buf.Tab("location")
+		buf.KV("desc", ev.region)
+		buf.End("},")
+		buf.End("},")
+	}
+
+	if ev.user != "" {
+		buf.Tab("actor")
+		buf.Tab("user")
+		buf.KV("name", ev.user)
+		buf.End("},")
+		buf.End("},")
+	}
+
+	if ev.err != nil {
+		buf.KV("status", "Failure")
+		buf.KV("status_detail", ev.err.Error())
+	}
+
+	buf.Tab("unmapped")
+	buf.KV("level", ev.level.Label(s.Lang(FormatOCSF)))
+	if ev.ref != "" {
+		buf.KV("msg_ref", ev.ref)
+		buf.KI("msg_size", ev.size)
+	}
+	if ev.err != nil {
+		buf.KV("error_type", errorType(ev.err))
+		buf.KV("error_chain", ev.errorField("error.chain"))
+	}
+	buf.KV("subject", ev.subject)
+	buf.KV("from", ev.from)
+	buf.KV("typeof", ev.typeof)
+	buf.KV("auth", ev.auth)
+	buf.KV("alert", ev.alert)
+	if ev.parent != "" {
+		buf.KV("parent_id", ev.parent)
+	}
+	if ev.rate > 0 && ev.rate < 1 {
+		buf.KV("sample_rate", ev.rate)
+	}
+	for _, a := range ev.attrs {
+		if ocsfUnmapped[a.key] {
+			buf.KV("attr."+a.key, a.val)
+			continue
+		}
+		buf.KV(a.key, a.val)
+	}
+	buf.End("},")
+	buf.End("}")
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"github.com/vela-security/vela-public/lua"
+)
+
+const (
+	FormatVela = "vela"
+	FormatECS  = "ecs"
+	FormatOCSF = "ocsf"
+)
+
+// schema typeof 到 ECS event.category 和 OCSF class_uid 的映射表 以及每种格式等级名称的语言
+type schema struct {
+	category map[string]string
+	class    map[string]int
+	lang     map[string]string
+}
+
+var defaultSchema = newSchema()
+
+func newSchema() *schema {
+	return &schema{
+		category: map[string]string{
+			"login":    "authentication",
+			"logout":   "authentication",
+			"process":  "process",
+			"file":     "file",
+			"network":  "network",
+			"portscan": "network",
+			"logger":   "host",
+		},
+
+		class: map[string]int{
+			"login":    3002, //Authentication
+			"logout":   3002,
+			"process":  1007, //Process Activity
+			"file":     1001, //File System Activity
+			"network":  4001, //Network Activity
+			"portscan": 4001,
+			"logger":   0, //Base Event
+		},
+
+		lang: map[string]string{},
+	}
+}
+
+func (s *schema) clone() *schema {
+	c := &schema{
+		category: make(map[string]string, len(s.category)),
+		class:    make(map[string]int, len(s.class)),
+		lang:     make(map[string]string, len(s.lang)),
+	}
+
+	for k, v := range s.category {
+		c.category[k] = v
+	}
+
+	for k, v := range s.class {
+		c.class[k] = v
+	}
+
+	for k, v := range s.lang {
+		c.lang[k] = v
+	}
+	return c
+}
+
+func (s *schema) Category(typeof string) string {
+	v, ok := s.category[typeof]
+	if !ok {
+		return "host"
+	}
+	return v
+}
+
+func (s *schema) Class(typeof string) int {
+	v, ok := s.class[typeof]
+	if !ok {
+		return 0
+	}
+	return v
+}
+
+// Lang 等级名称的语言 没有配置的格式使用中文
+func (s *schema) Lang(format string) string {
+	v, ok := s.lang[format]
+	if !ok {
+		return LangZH
+	}
+	return v
+}
+
+// labelsL 字符串对所有格式生效 表按照格式单独设置 labels = {ecs = "en"}
+func (s *schema) labelsL(L *lua.LState, val lua.LValue) {
+	set := func(format, lang string) {
+		if !checkFormat(format) {
+			L.RaiseError("invalid labels format %s", format)
+			return
+		}
+
+		if !checkLang(lang) {
+			L.RaiseError("invalid labels lang %s , must be zh or en", lang)
+			return
+		}
+		s.lang[format] = lang
+	}
+
+	switch val.Type() {
+	case lua.LTString:
+		for _, format := range []string{FormatVela, FormatECS, FormatOCSF} {
+			set(format, val.String())
+		}
+	case lua.LTTable:
+		val.(*lua.LTable).Range(func(format string, lv lua.LValue) {
+			set(format, lv.String())
+		})
+	default:
+		L.RaiseError("labels must be string or table , got %s", val.Type().String())
+	}
+}
+
+func (s *schema) ecsL(tab *lua.LTable) {
+	tab.Range(func(key string, val lua.LValue) {
+		s.category[key] = val.String()
+	})
+}
+
+func (s *schema) ocsfL(tab *lua.LTable) {
+	tab.Range(func(key string, val lua.LValue) {
+		s.class[key] = lua.IsInt(val)
+	})
+}
+
+// schema 绑定了审计对象的事件使用对象配置的映射表
+func (ev *Event) schema() *schema {
+	if ev.adt == nil {
+		return defaultSchema
+	}
+
+	if cfg := ev.adt.config(); cfg != nil && cfg.schema != nil {
+		return cfg.schema
+	}
+	return defaultSchema
+}
+
+func (ev *Event) encode(format string, s *schema) []byte {
+	switch format {
+	case FormatECS:
+		return ev.ecs(s)
+	case FormatOCSF:
+		return ev.ocsf(s)
+	default:
+		return ev.vela(s.Lang(FormatVela))
+	}
+}
+
+func checkFormat(v string) bool {
+	switch v {
+	case FormatVela, FormatECS, FormatOCSF:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,9 +1,7 @@
 package audit
 
 import (
-	"errors"
 	"fmt"
-	"github.com/vela-security/vela-public/catch"
 	"github.com/vela-security/vela-public/kind"
 	"github.com/vela-security/vela-public/lua"
 	"net"
@@ -14,21 +12,34 @@ import (
 
 const (
 	DISASTER string = "紧急"
+	SERIOUS  string = "严重"
 	HIGH     string = "重要"
 	MIDDLE   string = "次要"
 	NOTICE   string = "普通"
 )
 
+func (ev *Event) env() Env {
+	if ev.adt == nil {
+		return defaultEnv
+	}
+	return ev.adt.environ()
+}
+
 func (ev *Event) doRegion() {
-	ip, err := xEnv.Region(ev.rAddr)
+	region, err := ev.env().Region(ev.rAddr)
 	if err != nil {
-		xEnv.Debugf("vela-event region %s error %v", lua.B2L(ev.Byte()), err)
+		ev.env().Debugf("vela-event region %s error %v", lua.B2L(ev.Byte()), err)
 		return
 	}
-	ev.region = lua.B2S(ip.Byte())
+	ev.region = region
 }
 
 func (ev *Event) Byte() []byte {
+	return ev.vela(LangZH)
+}
+
+// vela 默认格式 level 按照 lang 输出名称 severity 固定输出数值
+func (ev *Event) vela(lang string) []byte {
 	if ev == nil {
 		return []byte{}
 	}
@@ -36,6 +47,14 @@ func (ev *Event) Byte() []byte {
 	buf := kind.NewJsonEncoder()
 	buf.Tab("")
 	buf.KV("time", ev.time)
+	buf.KV("event_id", ev.uid)
+	if ev.trace != "" {
+		buf.KV("trace_id", ev.trace)
+	}
+	if ev.parent != "" {
+		buf.KV("parent_id", ev.parent)
+	}
+	buf.KV("dedup_key", ev.DedupKey())
 	buf.KV("node_id", ev.id)
 	buf.KV("inet", ev.inet)
 	buf.KV("subject", ev.subject)
@@ -47,16 +66,43 @@ func (ev *Event) Byte() []byte {
 	buf.KV("user", ev.user)
 	buf.KV("auth", ev.auth)
 	buf.KV("msg", ev.msg)
-	buf.KV("error", ev.err)
+	if ev.ref != "" {
+		buf.KV("msg_ref", ev.ref)
+	}
+	if ev.size > 0 {
+		buf.KI("msg_size", ev.size)
+	}
+	ev.encodeError(buf)
 	buf.KV("alert", ev.alert)
-	buf.KV("level", ev.level)
+	buf.KV("level", ev.level.Label(lang))
+	buf.KI("severity", int(ev.level))
+	if ev.rate > 0 && ev.rate < 1 {
+		buf.KV("sample_rate", ev.rate)
+	}
+	if ev.roll != nil {
+		buf.KI("count", ev.roll.count)
+		buf.KV("first_time", ev.roll.first)
+		buf.KV("last_time", ev.roll.last)
+		buf.Tab("samples")
+		for _, s := range ev.roll.samples {
+			buf.KV(s.field, strings.Join(s.values, ","))
+		}
+		buf.End("},")
+	}
+	if len(ev.attrs) > 0 {
+		buf.Tab("attrs")
+		for _, a := range ev.attrs {
+			buf.KV(a.key, a.val)
+		}
+		buf.End("},")
+	}
 	buf.End("}")
 	return buf.Bytes()
 }
 
 func (ev *Event) toLine() string {
 	return fmt.Sprintf("[%s] [%s] [%s] %s  %s  %s  %d  %s  %s %s  %s  %s  %s  %v",
-		ev.level, ev.time, ev.id, ev.inet, ev.subject, ev.rAddr, ev.rPort, ev.from, ev.typeof,
+		ev.level.Label(LangZH), ev.time, ev.id, ev.inet, ev.subject, ev.rAddr, ev.rPort, ev.from, ev.typeof,
 		ev.user, ev.auth, ev.msg, ev.region, ev.err)
 }
 
@@ -78,7 +124,7 @@ func (ev *Event) Subject(format string, args ...interface{}) *Event {
 	if len(args) == 0 {
 		ev.subject = format
 	} else {
-		ev.subject = fmt.Sprintf(format, args)
+		ev.subject = fmt.Sprintf(format, args...)
 	}
 
 	return ev
@@ -163,6 +209,19 @@ func (ev *Event) Task() string {
 	return ev.from
 }
 
+func (ev *Event) Timestamp() time.Time {
+	return ev.time
+}
+
+// Attrs 附加属性的副本
+func (ev *Event) Attrs() map[string]string {
+	m := make(map[string]string, len(ev.attrs))
+	for _, a := range ev.attrs {
+		m[a.key] = a.val
+	}
+	return m
+}
+
 func (ev *Event) Typeof() string {
 	return ev.typeof
 }
@@ -187,6 +246,29 @@ func (ev *Event) Auth(v string) *Event {
 	return ev
 }
 
+// Attr 附加属性 同名属性会被覆盖 可以通过 attr.key 过滤
+func (ev *Event) Attr(key string, val interface{}) *Event {
+	v := fmt.Sprint(val)
+	for i := range ev.attrs {
+		if ev.attrs[i].key == key {
+			ev.attrs[i].val = v
+			return ev
+		}
+	}
+
+	ev.attrs = append(ev.attrs, attr{key: key, val: v})
+	return ev
+}
+
+func (ev *Event) attr(key string) string {
+	for _, a := range ev.attrs {
+		if a.key == key {
+			return a.val
+		}
+	}
+	return ""
+}
+
 func (ev *Event) E(e error) *Event {
 	ev.err = e
 	return ev
@@ -195,15 +277,15 @@ func (ev *Event) E(e error) *Event {
 func (ev *Event) Log() *Event {
 
 	if ev.err == nil {
-		xEnv.Debugf("[%s] [%s] %s %s %s %s %s %s %d %s",
-			ev.level, ev.subject, ev.from, ev.typeof,
+		ev.env().Debugf("[%s] [%s] %s %s %s %s %s %s %d %s",
+			ev.level.Label(LangZH), ev.subject, ev.from, ev.typeof,
 			ev.user, ev.auth, ev.msg, ev.rAddr, ev.rPort, ev.region)
 		//xEnv.Debug(ev.toLine())
 		return ev
 	}
 
-	xEnv.Errorf("[%s] [%s] %s %s %s %s %s %s %d %s %v",
-		ev.level, ev.subject, ev.from, ev.typeof,
+	ev.env().Errorf("[%s] [%s] %s %s %s %s %s %s %d %s %v",
+		ev.level.Label(LangZH), ev.subject, ev.from, ev.typeof,
 		ev.user, ev.auth, ev.msg, ev.rAddr, ev.rPort, ev.region, ev.err)
 
 	return ev
@@ -230,63 +312,69 @@ func (ev *Event) Log() *Event {
 	//return ev
 }
 
+// Level 兼容旧的参数 0 普通 , 1 次要 , 2 重要 , 3 严重 , 4 紧急
 func (ev *Event) Level(i int) {
-	switch i {
-	case 0:
-		ev.Notice()
-	case 1:
-		ev.Middle()
-	case 2:
-		ev.High()
-	case 4:
-		ev.Disaster()
+	s := Severity(i + 1)
+	if i < 0 || !s.valid() {
+		s = SeverityInfo
+	}
+	ev.level = s
+}
 
-	default:
-		ev.Notice()
+// SetSeverity 按照数值设置等级 超出范围的按照普通处理
+func (ev *Event) SetSeverity(s Severity) *Event {
+	if s == SeverityUnknown || !s.valid() {
+		s = SeverityInfo
+	}
+	ev.level = s
+	return ev
+}
+
+func (ev *Event) Severity() Severity {
+	return ev.level
+}
+
+// raise 提升一个等级 紧急不变
+func (ev *Event) raise() {
+	if ev.level < SeverityCritical {
+		ev.level++
 	}
 }
 
 func (ev *Event) Middle() *Event {
-	ev.level = MIDDLE
+	ev.level = SeverityLow
 	return ev
 }
 
 func (ev *Event) High() *Event {
-	ev.level = HIGH
+	ev.level = SeverityHigh
+	return ev
+}
+
+func (ev *Event) Serious() *Event {
+	ev.level = SeveritySerious
 	return ev
 }
 
 func (ev *Event) Disaster() *Event {
-	ev.level = DISASTER
+	ev.level = SeverityCritical
 	return ev
 }
 
 func (ev *Event) Notice() *Event {
-	ev.level = NOTICE
+	ev.level = SeverityInfo
 	return ev
 }
 
-func (ev *Event) check() {
-
-	if len(ev.msg) < 4096 {
-		return
-	}
-
-	if ev.err != nil {
-		cch := catch.New()
-		cch.Try("cause1", ev.err)
-		cch.Try("cause2", errors.New("\nmsg data to long > 4096"))
-		ev.E(cch.Wrap())
-		return
+// Put 提交到事件绑定的审计对象 没有绑定的提交到全局审计对象
+func (ev *Event) Put() {
+	adt := ev.adt
+	if adt == nil {
+		adt = CheckAdt()
 	}
-	ev.msg = ev.msg[0:4096]
-	ev.E(errors.New("msg data to long > 4096"))
-}
 
-func (ev *Event) Put() {
-	adt := CheckAdt()
 	if adt == nil {
-		xEnv.Errorf("not found audit object")
+		ev.env().Errorf("not found audit object")
 		return
 	}
 
@@ -295,9 +383,7 @@ func (ev *Event) Put() {
 	//	return
 	//}
 
-	ev.check()
-	ev.upload = true
-	adt.handle(ev)
+	adt.Put(ev)
 }
 
 func (ev *Event) Alert() *Event {
@@ -313,6 +399,12 @@ func (ev *Event) Field(key string) string {
 	switch key {
 	case "id":
 		return ev.id
+	case "event_id":
+		return ev.uid
+	case "trace_id":
+		return ev.trace
+	case "parent_id":
+		return ev.parent
 	case "inet":
 		return ev.inet
 	case "subject":
@@ -331,12 +423,17 @@ func (ev *Event) Field(key string) string {
 		return ev.auth
 	case "msg":
 		return ev.msg
-	case "err":
+	case "msg_ref":
+		return ev.ref
+	case "err", "error":
 		if ev.err == nil {
 			return ""
 		}
 		return ev.err.Error()
 
+	case "error.type", "error.cause", "error.cause_type", "error.chain", "error.stack":
+		return ev.errorField(key)
+
 	case "region":
 		return ev.region
 
@@ -353,12 +450,29 @@ func (ev *Event) Field(key string) string {
 			return "false"
 		}
 	case "level":
-		return ev.level
+		return ev.level.Label(LangZH)
+	case "severity":
+		return strconv.Itoa(int(ev.level))
 
 	case "raw":
 		return ev.String()
 
+	case "sample_rate":
+		if ev.rate == 0 {
+			return "1"
+		}
+		return strconv.FormatFloat(ev.rate, 'f', -1, 64)
+
+	case "count":
+		if ev.roll == nil {
+			return "1"
+		}
+		return strconv.Itoa(ev.roll.count)
+
 	default:
+		if strings.HasPrefix(key, "attr.") {
+			return ev.attr(key[5:])
+		}
 		return ""
 	}
 }
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"path/filepath"
+	"sync/atomic"
+)
+
+// 只在 go test 时编译 外部测试包通过这些入口配置规则 不需要lua虚拟机
+
+// UseTestConfig 所有文件写在dir下 去掉默认的限速规则 关闭本地存储和附件
+func (a *Audit) UseTestConfig(dir string) {
+	cfg := velaMinConfig()
+	cfg.file = filepath.Join(dir, "vela.audit.log")
+	cfg.ack = filepath.Join(dir, "vela.audit.ack")
+	cfg.spool = filepath.Join(dir, "vela.audit.spool")
+	cfg.inhibitFile = filepath.Join(dir, "vela.audit.inhibit")
+	cfg.store = ""
+	cfg.attach = ""
+	cfg.rate = nil
+	cfg.deadline = 1
+	a.reload(cfg)
+}
+
+// UseStore 开启本地存储
+func (a *Audit) UseStore(dir string) {
+	cfg := a.config().clone()
+	cfg.store = dir
+	a.reload(cfg)
+}
+
+// UseAttach 开启附件目录
+func (a *Audit) UseAttach(dir string) {
+	cfg := a.config().clone()
+	cfg.attach = dir
+	a.reload(cfg)
+}
+
+func (a *Audit) SetInhibit(tag string, ttl int, when string, escalate int) error {
+	r := newInhibitRule(tag, ttl)
+	r.escalate = escalate
+	if when != "" {
+		m, err := newCondition(when)
+		if err != nil {
+			return err
+		}
+		r.when = m
+	}
+
+	a.update(func(cfg *config) { cfg.rate = append(cfg.rate, r) })
+	return nil
+}
+
+func (a *Audit) SetRollup(tag string, window int, when string, sample ...string) error {
+	r := newRollupRule(tag, window)
+	r.sample = sample
+	if when != "" {
+		m, err := newCondition(when)
+		if err != nil {
+			return err
+		}
+		r.when = m
+	}
+
+	a.update(func(cfg *config) { cfg.rollup = append(cfg.rollup, r) })
+	return nil
+}
+
+func (a *Audit) SetSample(rate float64, tag string, when string) error {
+	r := newSampleRule(rate, tag)
+	if when != "" {
+		m, err := newCondition(when)
+		if err != nil {
+			return err
+		}
+		r.when = m
+	}
+
+	a.update(func(cfg *config) { cfg.sample = append(cfg.sample, r) })
+	return nil
+}
+
+func (a *Audit) SetPass(expr string) error {
+	m, err := newCondition(expr)
+	if err != nil {
+		return err
+	}
+
+	a.update(func(cfg *config) { cfg.pass = append(cfg.pass, m) })
+	return nil
+}
+
+// ReloadFormat 和 audit.new{} 重新执行一样 整体替换配置 限速规则和旁路清空
+func (a *Audit) ReloadFormat(format string) {
+	cfg := a.config().clone()
+	cfg.format = format
+	cfg.rate = nil
+	cfg.pass = nil
+	a.reload(cfg)
+}
+
+// ReloadCoroutine 和 audit.new{} 一样带着新的 pipe 虚拟机重新加载
+// reused 表示沿用了之前的虚拟机 closed 查看新建的虚拟机是否已经关闭
+func (a *Audit) ReloadCoroutine() (reused bool, closed func() bool) {
+	co := &coroutine{}
+	cfg := a.config().clone()
+	cfg.co = co
+	a.reload(cfg)
+
+	cur := a.config().co
+	return cur != co, func() bool {
+		cur.mu.Lock()
+		defer cur.mu.Unlock()
+		return cur.closed
+	}
+}
+
+// ExpireAttachment 和 retryLoop 每小时的清理一样
+func (a *Audit) ExpireAttachment() {
+	cfg := a.config()
+	expireAttachment(cfg.attach, cfg.attachDays, a.environ().Now())
+}
+
+// ExpireRollup 按照当前时间输出窗口已经结束的聚合事件 和 rollupLoop 一样
+func (a *Audit) ExpireRollup() int {
+	evs := a.roll.expire(a.environ().Now(), false)
+	for _, ev := range evs {
+		a.handle(ev)
+	}
+	return len(evs)
+}
+
+func (a *Audit) RetrySpool() (int, error) {
+	return a.dlv.retry(a.environ())
+}
+
+func (a *Audit) SpoolSize() int64 {
+	return a.dlv.size()
+}
+
+// Subscriber 测试里查看订阅的缓冲 丢弃和关闭状态
+type Subscriber = subscriber
+
+// SubscribeBuffer 和 adt.subscribe 一样注册订阅 不启动执行回调的协程 事件留在缓冲中
+func (a *Audit) SubscribeBuffer(vm, expr string) (*Subscriber, error) {
+	var when match
+	if expr != "" && expr != "*" {
+		m, err := newCondition(expr)
+		if err != nil {
+			return nil, err
+		}
+		when = m
+	}
+
+	s := &subscriber{
+		adt:  a,
+		vm:   vm,
+		expr: expr,
+		when: when,
+		ch:   make(chan *Event, subscribeBuffer),
+		stop: make(chan struct{}),
+	}
+	a.addSubscriber(s)
+	return s, nil
+}
+
+func (s *subscriber) Pending() int    { return len(s.ch) }
+func (s *subscriber) Dropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+func (s *subscriber) Closed() bool    { return s.closed() }
@@ -6,7 +6,12 @@ import (
 )
 
 func CheckAdt() *Audit {
-	return xEnv.Adt().(*Audit)
+	if xEnv == nil {
+		return nil
+	}
+
+	adt, _ := xEnv.Adt().(*Audit)
+	return adt
 }
 
 func checkout(L *lua.LState) bool {
@@ -27,10 +32,10 @@ func newAdtL(L *lua.LState) int {
 	cfg := newConfig(L)
 	proc := L.NewProc(adt.Name(), typeof)
 	if proc.IsNil() {
-		adt.cfg = cfg
+		adt.reload(cfg)
 		proc.Set(adt)
 	} else {
-		adt.cfg = cfg
+		adt.reload(cfg)
 	}
 
 	L.Push(proc)
@@ -56,10 +61,12 @@ func newAdtL(L *lua.LState) int {
 
 func WithEnv(env assert.Environment) {
 	xEnv = env
+	defaultEnv = agentEnv{env: env}
 	adt := lua.NewUserKV()
 	adt.Set("ev", lua.NewFunction(newLuaEvent))
 	adt.Set("event", lua.NewFunction(newLuaEvent))
 	adt.Set("new", lua.NewFunction(newAdtL))
+	adt.Set("subscribe", lua.NewFunction(subscribeL))
 	xEnv.Set("adt", adt)
 
 	xEnv.Set("event", lua.NewFunction(newLuaEvent))
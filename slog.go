@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"github.com/vela-security/vela-public/auxlib"
+	"log/slog"
+	"runtime"
+	"strconv"
+)
+
+// Handler 把 log/slog 的日志记录转换为审计事件 并通过 Event.Put 提交
+// 没有指定 HandlerAudit 时提交到全局审计对象
+//
+//	logger := slog.New(audit.NewHandler(audit.HandlerFrom("vela-kfk")))
+//	logger.Error("connect fail", "remote", "10.0.0.1:9092", "err", err)
+type Handler struct {
+	adt    *Audit
+	from   string
+	typeof string
+	level  slog.Leveler
+	attrs  []slog.Attr
+	group  string
+}
+
+type HandlerOption func(*Handler)
+
+// HandlerAudit 事件提交到指定的审计对象 例如 NewWithEnv 创建的
+func HandlerAudit(a *Audit) HandlerOption {
+	return func(h *Handler) { h.adt = a }
+}
+
+func HandlerFrom(v string) HandlerOption {
+	return func(h *Handler) { h.from = v }
+}
+
+func HandlerTypeof(v string) HandlerOption {
+	return func(h *Handler) { h.typeof = v }
+}
+
+func HandlerLevel(v slog.Leveler) HandlerOption {
+	return func(h *Handler) { h.level = v }
+}
+
+func NewHandler(opts ...HandlerOption) *Handler {
+	h := &Handler{typeof: "logger", level: slog.LevelInfo}
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+func (h *Handler) clone() *Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	return &c
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	c := h.clone()
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, prefixAttr(h.group, a))
+	}
+	return c
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	c := h.clone()
+	if c.group == "" {
+		c.group = name
+	} else {
+		c.group = c.group + "." + name
+	}
+	return c
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	var ev *Event
+	if h.adt != nil {
+		ev = h.adt.NewEvent(h.typeof)
+	} else {
+		ev = NewEvent(h.typeof)
+	}
+
+	ev.Msg("%s", r.Message)
+	if !r.Time.IsZero() {
+		ev.Time(r.Time)
+	}
+
+	slogLevel(ev, r.Level)
+	ev.From(h.from)
+	if r.PC != 0 {
+		fs := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := fs.Next()
+		if ev.from == "" {
+			ev.From(f.Function)
+		}
+		ev.Attr("source", f.File+":"+strconv.Itoa(f.Line))
+	}
+
+	for _, a := range h.attrs {
+		slogAttr(ev, "", a)
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		slogAttr(ev, h.group, a)
+		return true
+	})
+
+	ev.Put()
+	return nil
+}
+
+func slogLevel(ev *Event, level slog.Level) {
+	switch {
+	case level >= slog.LevelError+4:
+		ev.Subject("错误信息").Disaster()
+	case level >= slog.LevelError:
+		ev.Subject("错误信息").High()
+	case level >= slog.LevelWarn:
+		ev.Subject("告警信息").Middle()
+	case level >= slog.LevelInfo:
+		ev.Subject("事件信息").Notice()
+	default:
+		ev.Subject("调试信息").Notice()
+	}
+}
+
+func prefixAttr(group string, a slog.Attr) slog.Attr {
+	if group == "" {
+		return a
+	}
+	a.Key = group + "." + a.Key
+	return a
+}
+
+// slogAttr 约定的key会映射到事件字段 其他的作为附加属性
+func slogAttr(ev *Event, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		g := a.Key
+		if group != "" && g != "" {
+			g = group + "." + g
+		} else if g == "" {
+			g = group
+		}
+
+		for _, item := range a.Value.Group() {
+			slogAttr(ev, g, item)
+		}
+		return
+	}
+
+	if group != "" {
+		ev.Attr(group+"."+a.Key, a.Value.String())
+		return
+	}
+
+	switch a.Key {
+	case "subject":
+		ev.Subject(a.Value.String())
+	case "typeof":
+		ev.typeof = a.Value.String()
+	case "from":
+		ev.From(a.Value.String())
+	case "user":
+		ev.User(a.Value.String())
+	case "auth":
+		ev.Auth(a.Value.String())
+	case "remote", "remote_addr":
+		ev.Remote(a.Value.String())
+	case "remote_port":
+		if a.Value.Kind() == slog.KindInt64 {
+			ev.Port(int(a.Value.Int64()))
+		} else {
+			ev.Port(auxlib.ToInt(a.Value.String()))
+		}
+	case "alert":
+		ev.alert = a.Value.Kind() == slog.KindBool && a.Value.Bool()
+	case "err", "error":
+		if e, ok := a.Value.Any().(error); ok {
+			ev.E(e)
+		} else {
+			ev.E(errors.New(a.Value.String()))
+		}
+	default:
+		ev.Attr(a.Key, a.Value.String())
+	}
+}
@@ -0,0 +1,84 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	audit "github.com/vela-security/vela-audit"
+)
+
+func TestSlogLevel(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	logger := slog.New(audit.NewHandler(audit.HandlerAudit(adt), audit.HandlerLevel(slog.LevelDebug)))
+
+	cases := []struct {
+		level   slog.Level
+		want    audit.Severity
+		subject string
+	}{
+		{slog.LevelDebug, audit.SeverityInfo, "调试信息"},
+		{slog.LevelInfo, audit.SeverityInfo, "事件信息"},
+		{slog.LevelWarn, audit.SeverityLow, "告警信息"},
+		{slog.LevelError, audit.SeverityHigh, "错误信息"},
+		{slog.LevelError + 4, audit.SeverityCritical, "错误信息"},
+	}
+
+	for _, c := range cases {
+		rec.Reset()
+		logger.Log(context.Background(), c.level, "hello")
+
+		ev := rec.ExpectEvent(t, "logger")
+		if ev.Severity() != c.want || ev.Field("subject") != c.subject {
+			t.Fatalf("%s expect %d %s , got %d %s", c.level, c.want, c.subject, ev.Severity(), ev.Field("subject"))
+		}
+	}
+
+	//低于 HandlerLevel 的不提交
+	rec.Reset()
+	slog.New(audit.NewHandler(audit.HandlerAudit(adt))).Debug("skip")
+	if n := len(rec.Events()); n != 0 {
+		t.Fatalf("expect debug disabled , got %d", n)
+	}
+}
+
+func TestSlogAttrs(t *testing.T) {
+	adt, _, rec := newAudit(t)
+	h := audit.NewHandler(audit.HandlerAudit(adt), audit.HandlerFrom("vela-kfk"), audit.HandlerTypeof("kfk"))
+
+	logger := slog.New(h).With("user", "root").WithGroup("req").With("id", 7)
+	logger.Error("connect fail",
+		"path", "/a",
+		slog.Group("h", "ua", "curl"),
+		"err", errors.New("refused"))
+
+	ev := rec.ExpectEvent(t, "kfk")
+	fields := map[string]string{
+		"msg":           "connect fail",
+		"from":          "vela-kfk",
+		"user":          "root",
+		"attr.req.id":   "7",
+		"attr.req.path": "/a",
+		"attr.req.h.ua": "curl",
+		"attr.req.err":  "refused",
+	}
+	for k, v := range fields {
+		if got := ev.Field(k); got != v {
+			t.Fatalf("expect %s = %s , got %q", k, v, got)
+		}
+	}
+
+	if !strings.Contains(ev.Field("attr.source"), "slog_test.go:") {
+		t.Fatalf("expect source of the caller , got %q", ev.Field("attr.source"))
+	}
+
+	//没有分组时 约定的key映射到事件字段
+	rec.Reset()
+	slog.New(h).Warn("login", "remote", "10.0.0.1", "remote_port", 22, "alert", true, "err", errors.New("denied"))
+	ev = rec.ExpectAlert(t, "kfk")
+	if ev.Field("remote_addr") != "10.0.0.1" || ev.Field("remote_port") != "22" || ev.Field("error") != "denied" {
+		t.Fatalf("expect mapped fields , got %s", ev.String())
+	}
+}